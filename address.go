@@ -0,0 +1,198 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+//Network identifies a network of addresses.
+type Network byte
+
+//Networks of addresses.
+const (
+	Mainnet Network = iota
+	Testnet
+)
+
+//AddressVersion is the version of the address format.
+const AddressVersion = 1
+
+//AddressHashSize is the size of the hash of a public key in an address.
+const AddressHashSize = sha256.Size
+
+//addressDomain is the prefix of hashed public keys for domain separation.
+const addressDomain = "GLYPH address"
+
+var networkHRPs = map[Network]string{
+	Mainnet: "glyph",
+	Testnet: "tglyph",
+}
+
+func (n Network) hrp() (string, error) {
+	hrp, ok := networkHRPs[n]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown network %d", ErrInvalidFormat, byte(n))
+	}
+	return hrp, nil
+}
+
+//String returns the human-readable part of addresses on the network.
+func (n Network) String() string {
+	if hrp, ok := networkHRPs[n]; ok {
+		return hrp
+	}
+	return fmt.Sprintf("Network(%d)", byte(n))
+}
+
+/*
+Address is an account address, i.e. the hash of the framed encoding of a public key.
+The string form is Bech32m with the human-readable part of the network,
+whose data is the version followed by the hash.
+*/
+type Address struct {
+	Network Network
+	Version byte
+	Hash    [AddressHashSize]byte
+}
+
+func addressHash(pk *Publickey) [AddressHashSize]byte {
+	h := sha256.New()
+	h.Write([]byte(addressDomain))
+	h.Write(pk.Encode())
+	var hash [AddressHashSize]byte
+	copy(hash[:], h.Sum(nil))
+	return hash
+}
+
+//Address returns the address of pk on Mainnet.
+func (pk *Publickey) Address() (Address, error) {
+	return pk.NetworkAddress(Mainnet)
+}
+
+//NetworkAddress returns the address of pk on the network n.
+func (pk *Publickey) NetworkAddress(n Network) (Address, error) {
+	if _, err := n.hrp(); err != nil {
+		return Address{}, err
+	}
+	if err := pk.check(); err != nil {
+		return Address{}, err
+	}
+	return Address{
+		Network: n,
+		Version: AddressVersion,
+		Hash:    addressHash(pk),
+	}, nil
+}
+
+//ParseAddress parses s as an address and validates it.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	hrp, data, err := bech32mDecode(s)
+	if err != nil {
+		return a, err
+	}
+	found := false
+	for n, h := range networkHRPs {
+		if h == hrp {
+			a.Network = n
+			found = true
+		}
+	}
+	if !found {
+		return a, fmt.Errorf("%w: unknown network %q", ErrInvalidFormat, hrp)
+	}
+	b, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return a, err
+	}
+	if len(b) != 1+AddressHashSize {
+		return a, lengthError("address", len(b))
+	}
+	if b[0] != AddressVersion {
+		return a, fmt.Errorf("%w: address version %d", ErrUnknownVersion, b[0])
+	}
+	a.Version = b[0]
+	copy(a.Hash[:], b[1:])
+	return a, nil
+}
+
+//String returns the Bech32m string of the address, or a form like "Network(7):..." with the hex hash for an unknown network.
+func (a Address) String() string {
+	s, err := a.text()
+	if err != nil {
+		return fmt.Sprintf("%v:%d:%x", a.Network, a.Version, a.Hash)
+	}
+	return s
+}
+
+func (a Address) text() (string, error) {
+	hrp, err := a.Network.hrp()
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 0, 1+AddressHashSize)
+	b = append(b, a.Version)
+	b = append(b, a.Hash[:]...)
+	return encodeBech32m(hrp, b), nil
+}
+
+//MarshalText returns the string of the address, which implements encoding.TextMarshaler.
+//It returns an error for an unknown network.
+func (a Address) MarshalText() ([]byte, error) {
+	s, err := a.text()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+//UnmarshalText sets the address parsed by ParseAddress, which implements encoding.TextUnmarshaler.
+func (a *Address) UnmarshalText(s []byte) error {
+	aa, err := ParseAddress(string(s))
+	if err != nil {
+		return err
+	}
+	*a = aa
+	return nil
+}
+
+//Match returns true if pk is the public key of the address.
+func (a Address) Match(pk *Publickey) bool {
+	if pk.check() != nil {
+		return false
+	}
+	return a.Version == AddressVersion && a.Hash == addressHash(pk)
+}
+
+//Verify verifies the signature by pk after checking that pk is the public key of the address.
+func (a Address) Verify(pk *Publickey, sig *Signature, message []byte) error {
+	return a.VerifyWithOptions(pk, sig, message, nil)
+}
+
+//VerifyWithOptions verifies the signature signed with opts by pk after checking that pk is the public key of the address.
+func (a Address) VerifyWithOptions(pk *Publickey, sig *Signature, message []byte, opts *SignOptions) error {
+	if !a.Match(pk) {
+		return ErrAddressMismatch
+	}
+	return pk.VerifyWithOptions(sig, message, opts)
+}
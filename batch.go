@@ -0,0 +1,155 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AidosKuneen/numcpu"
+)
+
+/*
+BatchError is returned by VerifyBatch when some of signatures are invalid.
+Note that signatures signed with options (e.g. a context) are always invalid for VerifyBatch,
+and must be verified by VerifyBatchWithOptions or VerifyWithOptions.
+*/
+type BatchError struct {
+	//Errs[i] is the error of the i-th signature, or nil if it is valid.
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d signatures are invalid", len(e.Failed()), len(e.Errs))
+}
+
+//Failed returns indices of invalid signatures.
+func (e *BatchError) Failed() []int {
+	var f []int
+	for i, err := range e.Errs {
+		if err != nil {
+			f = append(f, i)
+		}
+	}
+	return f
+}
+
+/*
+VerifyBatch verifies sigs[i] of messages[i] by pks[i] for all i.
+It returns nil if all signatures are valid, or *BatchError which reports invalid ones.
+Cheap checks are done first for all entries so that malformed ones fail early,
+each distinct public key is validated and prepared only once, and the rest is done by parallel workers.
+Signatures must be signed without options, e.g. by SignMessage.
+Use VerifyBatchWithOptions for ones by SignWithContext, SignPrehash and so on.
+*/
+func VerifyBatch(pks []Publickey, sigs []Signature, messages [][]byte) error {
+	return VerifyBatchWithOptions(pks, sigs, messages, nil)
+}
+
+/*
+VerifyBatchWithOptions is same as VerifyBatch, but sigs[i] is verified with opts[i] like VerifyWithOptions.
+opts can be nil if all signatures are signed without options, and opts[i] can be nil likewise.
+*/
+func VerifyBatchWithOptions(pks []Publickey, sigs []Signature, messages [][]byte, opts []*SignOptions) error {
+	if len(pks) != len(sigs) || len(sigs) != len(messages) || (opts != nil && len(opts) != len(sigs)) {
+		return fmt.Errorf("%w: lengths of pks, sigs, messages and opts must be same", ErrInvalidOptions)
+	}
+	errs := make([]error, len(sigs))
+	doms := make([][]byte, len(sigs))
+	todo := make([]int, 0, len(sigs))
+	prepared := make([]*PreparedPublicKey, len(sigs))
+	type preparedKey struct {
+		p   *PreparedPublicKey
+		err error
+	}
+	keys := make(map[string]preparedKey)
+	for i := range sigs {
+		o := &SignOptions{}
+		if opts != nil && opts[i] != nil {
+			o = opts[i]
+		}
+		if doms[i], errs[i] = o.domain(messages[i]); errs[i] != nil {
+			continue
+		}
+		if errs[i] = sigs[i].checkCoefficients(); errs[i] != nil {
+			continue
+		}
+		id := pks[i].id()
+		k, ok := keys[id]
+		if !ok {
+			k.p, k.err = pks[i].Prepare()
+			keys[id] = k
+		}
+		if errs[i] = k.err; errs[i] != nil {
+			continue
+		}
+		if errs[i] = sigs[i].check(); errs[i] != nil {
+			continue
+		}
+		if errs[i] = paramsError(pks[i].Params(), sigs[i].Params()); errs[i] != nil {
+			continue
+		}
+		prepared[i] = k.p
+		todo = append(todo, i)
+	}
+
+	workers := numcpu.NumCPU()
+	if workers > len(todo) {
+		workers = len(todo)
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				n := int(atomic.AddInt64(&next, 1))
+				if n >= len(todo) {
+					return
+				}
+				i := todo[n]
+				errs[i] = prepared[i].verifyChecked(&sigs[i], doms[i], messages[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{
+				Errs: errs,
+			}
+		}
+	}
+	return nil
+}
+
+/*id returns a string which identifies pk, i.e. the name of the parameter set and raw coefficients.*/
+func (pk *Publickey) id() string {
+	b := make([]byte, 0, len(pk.Params().name)+2*len(pk.t))
+	b = append(b, pk.Params().name...)
+	for _, t := range pk.t {
+		b = append(b, byte(t), byte(t>>8))
+	}
+	return string(b)
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+/*
+Constant-time arithmetic for signing and key generation.
+Values derived from s1, s2, y1, y2 and z are processed without branches or memory accesses
+depending on them, by masks (all ones or all zeros) and Barrett reduction instead of % and /.
+The challenge c is public (it is a part of the signature), so it may select memory locations.
+The only exception is sampleGLPSecret, which rejects random 2-bit values of 3 by a branch.
+Its running time reveals the number of rejected values, which are discarded and independent of s1 and s2.
+Faster variable-time helpers such as addMOD and sparseMul are only for verification.
+*/
+
+/*ctMask returns all ones if b is 1, or 0 if b is 0.*/
+func ctMask(b uint32) uint32 {
+	return -b
+}
+
+/*ctLT returns all ones if a < b, or 0 otherwise, where a, b < 2^31.*/
+func ctLT(a, b uint32) uint32 {
+	return ctMask((a - b) >> 31)
+}
+
+/*ctEQ returns all ones if a == b, or 0 otherwise, where a, b < 2^31.*/
+func ctEQ(a, b uint32) uint32 {
+	return ctMask(((a ^ b) - 1) >> 31)
+}
+
+/*ctSelect returns a if m is all ones, or b if m is 0.*/
+func ctSelect(m uint32, a, b ringelt) ringelt {
+	return ringelt(uint32(b) ^ (m & (uint32(a) ^ uint32(b))))
+}
+
+/*initReduction computes constants for Barrett reduction and division by 2K+1.*/
+func (p *Params) initReduction() {
+	p.barrett = (1 << 32) / uint64(p.q)
+	/*floor(x*m/2^32) = floor(x/d) for all x < 2^16, because x/2^32 < 1/d*/
+	p.kDiv = (1<<32)/uint64(2*p.k()+1) + 1
+}
+
+func (p *Params) ctAddMOD(a, b ringelt) ringelt {
+	x := uint32(a) + uint32(b) - uint32(p.q)
+	x += uint32(p.q) & ctMask(x>>31)
+	return ringelt(x)
+}
+
+func (p *Params) ctSubMOD(a, b ringelt) ringelt {
+	x := uint32(a) - uint32(b)
+	x += uint32(p.q) & ctMask(x>>31)
+	return ringelt(x)
+}
+
+func (p *Params) ctMulMOD(a, b ringelt) ringelt {
+	x := uint32(a) * uint32(b)
+	/*the estimated quotient is floor(x/q) or floor(x/q)-1*/
+	t := uint32((uint64(x) * p.barrett) >> 32)
+	x -= t * uint32(p.q)
+	x -= uint32(p.q)
+	x += uint32(p.q) & ctMask(x>>31)
+	return ringelt(x)
+}
+
+/*ctAbs is abs without branches.*/
+func (p *Params) ctAbs(x ringelt) ringelt {
+	return ctSelect(ctLT(uint32(p.q), 2*uint32(x)), p.q-x, x)
+}
+
+/*ctPositive returns all ones if sign(x) > 0, or 0 otherwise.*/
+func (p *Params) ctPositive(x ringelt) uint32 {
+	return ^ctEQ(uint32(x), 0) & ^ctLT(uint32(p.q), 2*uint32(x))
+}
+
+/*divK returns x/(2K+1) for x < 2^16 without division.*/
+func (p *Params) divK(x ringelt) ringelt {
+	return ringelt((uint64(x) * p.kDiv) >> 32)
+}
+
+/*ctExceeds returns non-zero if |f[i]| > K for some i, after checking all coefficients.*/
+func (p *Params) ctExceeds(f []ringelt) uint32 {
+	k := uint32(p.k())
+	var m uint32
+	for _, x := range f {
+		m |= ctLT(k, uint32(p.ctAbs(x)))
+	}
+	return m
+}
+
+/*ctIsConst is isConst without early return.*/
+func ctIsConst(v []ringelt, c ringelt) bool {
+	m := ^uint32(0)
+	for _, x := range v {
+		m &= ctEQ(uint32(x), uint32(c))
+	}
+	return m != 0
+}
+
+/*ctInvalidSecret returns non-zero if some coefficient of s is not in {0, 1, Q-1}.*/
+func (p *Params) ctInvalidSecret(s []ringelt) uint32 {
+	var m uint32
+	for _, x := range s {
+		m |= ^(ctEQ(uint32(x), 0) | ctEQ(uint32(x), 1) | ctEQ(uint32(x), uint32(p.q-1)))
+	}
+	return m
+}
+
+/*ctSparseMul is sparseMul for secret a, selecting addition or subtraction by the sign of c with a mask.*/
+func (p *Params) ctSparseMul(a []ringelt, b sparsePolyST) []ringelt {
+	vaux := make([]ringelt, 2*p.n)
+	v := p.newPoly()
+
+	/*multiply in Z[x]*/
+	for _, vb := range b {
+		var sign uint32
+		if vb.sign {
+			sign = 1
+		}
+		m := ctMask(sign)
+		for j := 0; j < p.n; j++ {
+			x := vaux[int(vb.pos)+j]
+			vaux[int(vb.pos)+j] = ctSelect(m, p.ctAddMOD(x, a[j]), p.ctSubMOD(x, a[j]))
+		}
+	}
+	/*reduce mod x^n + 1*/
+	for i := 0; i < p.n; i++ {
+		v[i] = p.ctSubMOD(vaux[i], vaux[i+p.n])
+	}
+	wipePoly(vaux)
+	return v
+}
+
+func (p *Params) ctPointwiseAdd(b, e0 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.ctAddMOD(e0[i], b[i])
+	}
+	return v
+}
+
+func (p *Params) ctPointwiseSub(b, e0 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.ctSubMOD(b[i], e0[i])
+	}
+	return v
+}
+
+func (p *Params) ctPointwiseMulAdd(b, e0, e1 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.ctAddMOD(p.ctMulMOD(e0[i], b[i]), e1[i])
+	}
+	return v
+}
+
+/*ctCompressCoefficient is compressCoefficient without branches, where |v| <= K.*/
+func (p *Params) ctCompressCoefficient(u, v ringelt) ringelt {
+	k := p.k()
+	kfloorUV := uint32(p.divK(p.ctAddMOD(u, v)))
+	kfloorU := uint32(p.divK(u))
+
+	/*select in the reverse order of priority*/
+	r := ctSelect(ctLT(kfloorUV, kfloorU), p.q-k, k)
+	r = ctSelect(^ctLT(uint32(u), uint32(p.q-k))&p.ctPositive(v), k, r)
+	r = ctSelect(ctLT(uint32(u), uint32(k)), p.q-k, r)
+	return ctSelect(ctEQ(kfloorUV, kfloorU), 0, r)
+}
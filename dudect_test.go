@@ -0,0 +1,245 @@
+//go:build dudect
+// +build dudect
+
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"flag"
+	"math"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+/*
+Timing leakage tests in the style of dudect (Reparaz, Balasch and Verbauwhede, "Dude, is my code constant time?").
+Execution times are measured for two classes of secret inputs, a fixed one and random ones, chosen in random order,
+and Welch's t-test checks whether their distributions differ.
+Inputs are prepared outside of the measurement, and public inputs are the same for both classes.
+Run with:
+
+	go test -tags dudect -run TestDudect -v [-dudect.n 20000] [-dudect.threshold 10]
+*/
+
+var (
+	dudectN         = flag.Int("dudect.n", 10000, "number of measurements per function")
+	dudectThreshold = flag.Float64("dudect.threshold", 10, "maximum absolute t-statistic regarded as constant time")
+)
+
+/*percentiles for cropping measurements, to remove outliers by interrupts and so on*/
+var dudectPercentiles = []float64{1, 0.99, 0.9, 0.5}
+
+/*welch accumulates means and variances of two classes by Welford's method.*/
+type welch struct {
+	n    [2]float64
+	mean [2]float64
+	m2   [2]float64
+}
+
+func (w *welch) push(class int, x float64) {
+	w.n[class]++
+	d := x - w.mean[class]
+	w.mean[class] += d / w.n[class]
+	w.m2[class] += d * (x - w.mean[class])
+}
+
+func (w *welch) t() float64 {
+	if w.n[0] < 2 || w.n[1] < 2 {
+		return 0
+	}
+	v0 := w.m2[0] / (w.n[0] - 1)
+	v1 := w.m2[1] / (w.n[1] - 1)
+	if v0+v1 == 0 {
+		return 0
+	}
+	return (w.mean[0] - w.mean[1]) / math.Sqrt(v0/w.n[0]+v1/w.n[1])
+}
+
+/*
+dudect measures run after setup(class) for random classes (0: fixed secret, 1: random secret)
+and fails if the largest absolute t-statistic over cropped measurements exceeds the threshold.
+*/
+func dudect(t *testing.T, name string, setup func(class int), run func()) {
+	n := *dudectN
+	r := newCrand()
+	classes := make([]int, n)
+	times := make([]float64, n)
+	runtime.GC()
+	for i := range classes {
+		classes[i] = int(r.get16() & 1)
+		setup(classes[i])
+		start := time.Now()
+		run()
+		times[i] = float64(time.Since(start))
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	/*discard warming up*/
+	classes, times = classes[n/10:], times[n/10:]
+	sorted := append([]float64(nil), times...)
+	sort.Float64s(sorted)
+
+	var maxT float64
+	for _, p := range dudectPercentiles {
+		limit := sorted[int(p*float64(len(sorted)-1))]
+		var w welch
+		for i, x := range times {
+			if x <= limit {
+				w.push(classes[i], x)
+			}
+		}
+		tt := w.t()
+		t.Logf("%s: percentile %.2f: t = %.2f (n = %.0f, %.0f, mean = %.0fns, %.0fns)",
+			name, p, tt, w.n[0], w.n[1], w.mean[0], w.mean[1])
+		if math.Abs(tt) > math.Abs(maxT) {
+			maxT = tt
+		}
+	}
+	if math.Abs(maxT) > *dudectThreshold {
+		t.Errorf("%s: timing leakage is detected: t = %.2f", name, maxT)
+	}
+}
+
+func TestDudect(t *testing.T) {
+	for _, params := range []*Params{ParamsCompact, ParamsOriginal, ParamsHigh} {
+		params := params
+		t.Run(params.Name(), func(t *testing.T) {
+			dudectParams(t, params)
+		})
+	}
+}
+
+/*dudectPool is the number of pre-generated random secrets for class 1.*/
+const dudectPool = 64
+
+/*dudectSink keeps touched values so that touching is not eliminated by the compiler.*/
+var dudectSink ringelt
+
+/*touch reads all coefficients of fs, so that secrets of both classes are in the cache in the same way.*/
+func touch(fs ...[]ringelt) {
+	for _, f := range fs {
+		for _, x := range f {
+			dudectSink += x
+		}
+	}
+}
+
+/*dudectSecret is a signing key with y1,y2 which are accepted when signing the message with it.*/
+type dudectSecret struct {
+	sk     *SigningKey
+	y1, y2 []ringelt
+	b      []byte
+}
+
+func dudectParams(t *testing.T, params *Params) {
+	message := []byte("message")
+	r := newCrand()
+	/*
+		Secrets of both classes are generated before measuring. y1,y2 are chosen so that signing is not rejected,
+		because early returns by rejections add noise independent of the class and hide leakages.
+	*/
+	newSecret := func() *dudectSecret {
+		sk, err := params.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			y1, y2, err := r.sampleY(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sk.deterministicSign(y1, y2, nil, message); err == nil {
+				return &dudectSecret{sk: sk, y1: y1, y2: y2, b: sk.Bytes()}
+			}
+		}
+	}
+	fixed := newSecret()
+	pool := make([]*dudectSecret, dudectPool)
+	for i := range pool {
+		pool[i] = newSecret()
+	}
+	choose := func(class int) *dudectSecret {
+		s := fixed
+		if class == 1 {
+			s = pool[int(r.get16())%len(pool)]
+		}
+		touch(s.sk.s1, s.sk.s2, s.y1, s.y2)
+		return s
+	}
+
+	var s *dudectSecret
+	dudect(t, "deterministicSign", func(class int) {
+		s = choose(class)
+	}, func() {
+		if _, err := s.sk.deterministicSign(s.y1, s.y2, nil, message); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	sig, err := fixed.sk.SignMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dudect(t, "sparseMul", func(class int) {
+		s = choose(class)
+	}, func() {
+		params.ctSparseMul(s.sk.s1, sig.c)
+	})
+
+	/*u and v = z2 before compression, with |v| <= K*/
+	k := params.k()
+	uvs := make([][2][]ringelt, dudectPool+1)
+	for j := range uvs {
+		u := params.newPoly()
+		v := params.newPoly()
+		for i := range u {
+			u[i] = ringelt(uint32(r.get16()) * uint32(params.q) >> 16)
+			v[i] = ringelt(uint32(r.get16()) * uint32(2*k+1) >> 16)
+			v[i] = params.ctAddMOD(v[i], params.q-k)
+		}
+		uvs[j] = [2][]ringelt{u, v}
+	}
+	var u, v []ringelt
+	dudect(t, "compressCoefficient", func(class int) {
+		j := 0
+		if class == 1 {
+			j = 1 + int(r.get16())%dudectPool
+		}
+		u, v = uvs[j][0], uvs[j][1]
+		touch(u, v)
+	}, func() {
+		for i := range u {
+			params.ctCompressCoefficient(u[i], v[i])
+		}
+	})
+
+	dudect(t, "NewSigningKey", func(class int) {
+		s = choose(class)
+	}, func() {
+		if _, err := params.NewSigningKey(s.b); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"errors"
+	"fmt"
+)
+
+//Errors which can be tested with errors.Is.
+var (
+	//ErrInvalidLength is an error about the length of encoded bytes.
+	ErrInvalidLength = errors.New("invalid length of bytes")
+	//ErrInvalidPublicKey is an error about a malformed public key.
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	//ErrInvalidSigningKey is an error about a malformed signing key.
+	ErrInvalidSigningKey = errors.New("invalid signing key")
+	//ErrMalformedSignature is an error about a signature which is not well-formed.
+	ErrMalformedSignature = errors.New("malformed signature")
+	//ErrInvalidSignature is an error about a well-formed signature which doesn't match the message and the public key.
+	ErrInvalidSignature = errors.New("invalid signature")
+	//ErrInvalidOptions is an error about SignOptions, e.g. too long context or unavailable hash function.
+	ErrInvalidOptions = errors.New("invalid options")
+	//ErrSignerClosed is returned when signing with a closed Signer.
+	ErrSignerClosed = errors.New("signer is closed")
+	//ErrUnknownParams is an error about a name of a parameter set which is not defined.
+	ErrUnknownParams = errors.New("unknown parameter set")
+	//ErrInvalidFormat is an error about the header of the framed encoding.
+	ErrInvalidFormat = errors.New("invalid format")
+	//ErrUnknownVersion is an error about a version of the framed encoding which is not supported.
+	ErrUnknownVersion = errors.New("unknown format version")
+	//ErrInvalidChecksum is an error about a checksum of a text form, e.g. by a typo.
+	ErrInvalidChecksum = errors.New("invalid checksum")
+	//ErrAddressMismatch is returned when a public key is not the one of an address.
+	ErrAddressMismatch = errors.New("public key does not match the address")
+	//ErrSecureMemoryUnsupported is returned when secure memory is not supported on the platform.
+	ErrSecureMemoryUnsupported = errors.New("secure memory is not supported")
+	//ErrSecretExport is returned when marshaling a SigningKey implicitly, e.g. by json.Marshal; use Exportable to export it.
+	ErrSecretExport = errors.New("signing key must be exported explicitly by Exportable")
+	//ErrParamsMismatch is returned when keys and signatures of different parameter sets are used together.
+	ErrParamsMismatch = errors.New("parameter sets mismatch")
+
+	/*errRejected is an internal error when a trial of signing is rejected*/
+	errRejected = errors.New("rejected")
+)
+
+/*
+CoefficientError is an error about a field (t of a public key, s1 or s2 of a signing key,
+z1, z2 or c of a signature).
+Err is one of ErrInvalidPublicKey, ErrInvalidSigningKey, ErrMalformedSignature or ErrInvalidSignature.
+*/
+type CoefficientError struct {
+	//Field is the name of the field.
+	Field string
+	//Index is the index of the failing coefficient, or -1 if the field is invalid as a whole.
+	//It is always -1 for s1 and s2 so that secrets never leak into errors.
+	Index int
+	//Value is the failing coefficient. It is 0 if Index is -1.
+	Value uint16
+	Err   error
+}
+
+func (e *CoefficientError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%v: invalid %s", e.Err, e.Field)
+	}
+	return fmt.Sprintf("%v: invalid %s[%d]=%d", e.Err, e.Field, e.Index, e.Value)
+}
+
+//Unwrap returns e.Err.
+func (e *CoefficientError) Unwrap() error {
+	return e.Err
+}
+
+func lengthError(name string, l int) error {
+	return fmt.Errorf("%w for %s: %d", ErrInvalidLength, name, l)
+}
+
+func optionsError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidOptions, msg)
+}
+
+func paramsError(a, b *Params) error {
+	if a == b {
+		return nil
+	}
+	return fmt.Errorf("%w: %v and %v", ErrParamsMismatch, a, b)
+}
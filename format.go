@@ -0,0 +1,132 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+)
+
+//FingerprintSize is the size of a fingerprint of a key.
+const FingerprintSize = 4
+
+//Fingerprint returns the first 4 bytes of the hash of pk, which identifies pk without exposing it.
+func (p *Publickey) Fingerprint() []byte {
+	h := sha256.Sum256(p.Bytes())
+	return h[:FingerprintSize]
+}
+
+//Fingerprint returns the fingerprint of the public key of sk.
+func (s *SigningKey) Fingerprint() ([]byte, error) {
+	pk, err := s.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return pk.Fingerprint(), nil
+}
+
+/*redacted returns the description of sk, which never includes s1, s2 and the seed.*/
+func (s *SigningKey) redacted() string {
+	if s.params == nil || s.s1 == nil {
+		return "invalid"
+	}
+	fp, err := s.Fingerprint()
+	if err != nil {
+		return s.params.String() + " invalid"
+	}
+	return fmt.Sprintf("%s %x", s.params, fp)
+}
+
+//String returns the parameter set and the fingerprint of sk, which implements fmt.Stringer.
+//Secrets are never printed.
+func (s SigningKey) String() string {
+	return "SigningKey(" + s.redacted() + ")"
+}
+
+//GoString returns the redacted Go syntax of sk, which implements fmt.GoStringer.
+func (s SigningKey) GoString() string {
+	return "glyph.SigningKey{" + strconv.Quote(s.redacted()) + "}"
+}
+
+//Format implements fmt.Formatter so that no verb (e.g. %v, %+v, %#v, %x, %d) prints secrets of sk.
+func (s SigningKey) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, s.String(), s.GoString(), "glyph.SigningKey")
+}
+
+//String returns the same redacted string as SigningKey.String.
+func (e ExportableSigningKey) String() string {
+	return SigningKey(e).String()
+}
+
+//GoString returns the redacted Go syntax of e, which implements fmt.GoStringer.
+func (e ExportableSigningKey) GoString() string {
+	return "glyph.ExportableSigningKey{" + strconv.Quote((*SigningKey)(&e).redacted()) + "}"
+}
+
+//Format implements fmt.Formatter so that no verb prints secrets of e.
+func (e ExportableSigningKey) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, e.String(), e.GoString(), "glyph.ExportableSigningKey")
+}
+
+//String returns the depth, the index and the fingerprint of k, which implements fmt.Stringer.
+//The seed and the chain code are never printed.
+func (k ExtendedKey) String() string {
+	fp, err := k.Fingerprint()
+	if err != nil {
+		return "ExtendedKey(invalid)"
+	}
+	return fmt.Sprintf("ExtendedKey(depth %d, index %d, %x)", k.depth, k.index, fp)
+}
+
+//GoString returns the redacted Go syntax of k, which implements fmt.GoStringer.
+func (k ExtendedKey) GoString() string {
+	return "glyph.ExtendedKey{" + strconv.Quote(k.String()) + "}"
+}
+
+//Format implements fmt.Formatter so that no verb prints secrets of k.
+func (k ExtendedKey) Format(f fmt.State, verb rune) {
+	formatRedacted(f, verb, k.String(), k.GoString(), "glyph.ExtendedKey")
+}
+
+/*
+formatRedacted writes str for %s and %v, strconv.Quote(str) for %q, gostr for %#v,
+and %!verb(typ=str) for other verbs, with the width and the '-' flag of f.
+*/
+func formatRedacted(f fmt.State, verb rune, str, gostr, typ string) {
+	switch {
+	case verb == 'v' && f.Flag('#'):
+		str = gostr
+	case verb == 's' || verb == 'v':
+	case verb == 'q':
+		str = strconv.Quote(str)
+	default:
+		str = "%!" + string(verb) + "(" + typ + "=" + str + ")"
+	}
+	format := "%"
+	if f.Flag('-') {
+		format += "-"
+	}
+	if w, ok := f.Width(); ok {
+		format += strconv.Itoa(w)
+	}
+	fmt.Fprintf(f, format+"s", str)
+}
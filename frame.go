@@ -0,0 +1,100 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import "fmt"
+
+/*
+The framed encoding is
+	magic ("GLY") || version || kind || id of the parameter set || raw form by Bytes,
+so that stored keys and signatures remain decodable after packing or parameter sets change.
+Decoders also accept the legacy raw form of ParamsCompact, which is distinguished by its length.
+*/
+
+//FormatVersion is the version of the framed encoding made by Encode.
+const FormatVersion = 1
+
+const (
+	wireMagic  = "GLY"
+	headerSize = len(wireMagic) + 3
+)
+
+/*kinds of encoded objects*/
+const (
+	kindPublickey byte = iota + 1
+	kindSigningKey
+	kindSignature
+)
+
+func (params *Params) frame(kind byte, raw []byte) []byte {
+	b := make([]byte, 0, headerSize+len(raw))
+	b = append(b, wireMagic...)
+	b = append(b, FormatVersion, kind, params.id)
+	return append(b, raw...)
+}
+
+/*
+unframe returns the parameter set and the raw form in b.
+If the length of b is legacySize of params (ParamsCompact if nil), b is the legacy raw form of it.
+Otherwise b must be framed, and its parameter set must be params if params is not nil.
+*/
+func unframe(params *Params, b []byte, kind byte, name string, legacySize func(*Params) int) (*Params, []byte, error) {
+	lp := paramsOrDefault(params)
+	if len(b) == legacySize(lp) {
+		return lp, b, nil
+	}
+	if len(b) < headerSize || string(b[:len(wireMagic)]) != wireMagic {
+		return nil, nil, lengthError(name, len(b))
+	}
+	if v := b[len(wireMagic)]; v != FormatVersion {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+	}
+	if k := b[len(wireMagic)+1]; k != kind {
+		return nil, nil, fmt.Errorf("%w: kind %d is not %s", ErrInvalidFormat, k, name)
+	}
+	p, err := paramsByID(b[len(wireMagic)+2])
+	if err != nil {
+		return nil, nil, err
+	}
+	if params != nil {
+		if err := paramsError(params, p); err != nil {
+			return nil, nil, err
+		}
+	}
+	return p, b[headerSize:], nil
+}
+
+//Encode serializes Publickey with the header of the framed encoding.
+func (p *Publickey) Encode() []byte {
+	return p.Params().frame(kindPublickey, p.Bytes())
+}
+
+//Encode serializes SigningKey in the expanded form with the header of the framed encoding.
+func (s *SigningKey) Encode() []byte {
+	raw := s.Bytes()
+	defer wipe(raw)
+	return s.Params().frame(kindSigningKey, raw)
+}
+
+//Encode serializes Signature with the header of the framed encoding.
+func (s *Signature) Encode() []byte {
+	return s.Params().frame(kindSignature, s.Bytes())
+}
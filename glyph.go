@@ -22,184 +22,353 @@ package glyph
 
 import (
 	"context"
-	"errors"
-	"time"
-
-	"github.com/AidosKuneen/numcpu"
+	"crypto"
+	"crypto/rand"
+	"crypto/subtle"
+	"io"
 )
 
 /*
 NewSK generates signing key (s1,s2) from the key, stored in physical form.
 The key must be 32 bytes.
+
+Deprecated: It panics if key is invalid. Use NewKeyFromSeed instead.
 */
 func NewSK(key []byte) *SigningKey {
-	sk := &SigningKey{}
-	var err error
-	sk.s1, sk.s2, err = sampleGLPSecrets(key)
+	sk, err := NewKeyFromSeed(key)
 	if err != nil {
 		panic(err)
 	}
+	return sk
+}
+
+//SeedSize is the size of a seed of a signing key.
+const SeedSize = 32
+
+/*
+NewKeyFromSeed generates signing key (s1,s2) of ParamsCompact from the seed, stored in physical form.
+The seed must be SeedSize bytes. It is copied into the key, so the caller may wipe it after that.
+*/
+func NewKeyFromSeed(seed []byte) (*SigningKey, error) {
+	return ParamsCompact.NewKeyFromSeed(seed)
+}
+
+//NewKeyFromSeed is same as the function NewKeyFromSeed, but generates a key of the parameter set p.
+func (p *Params) NewKeyFromSeed(seed []byte) (*SigningKey, error) {
+	if len(seed) != SeedSize {
+		return nil, lengthError("seed", len(seed))
+	}
+	sk := &SigningKey{
+		params: p,
+		seed:   append([]byte(nil), seed...),
+	}
+	var err error
+	sk.s1, sk.s2, err = p.sampleGLPSecrets(seed)
+	if err != nil {
+		sk.Destroy()
+		return nil, err
+	}
 	if err := sk.check(); err != nil {
-		panic(err)
+		sk.Destroy()
+		return nil, err
 	}
-	return sk
+	return sk, nil
 }
 
-/*PK takes a signing key stored in physical space and computes the public key in physical space */
-/*points a1, a2 are stored in FFT space */
+/*
+GenerateKey generates a signing key of ParamsCompact from a seed read from rnd.
+If rnd is nil, crypto/rand.Reader is used.
+*/
+func GenerateKey(rnd io.Reader) (*SigningKey, error) {
+	return ParamsCompact.GenerateKey(rnd)
+}
+
+//GenerateKey is same as the function GenerateKey, but generates a key of the parameter set p.
+func (p *Params) GenerateKey(rnd io.Reader) (*SigningKey, error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	seed := make([]byte, SeedSize)
+	defer wipe(seed)
+	if _, err := io.ReadFull(rnd, seed); err != nil {
+		return nil, err
+	}
+	return p.NewKeyFromSeed(seed)
+}
+
+/*
+Destroy overwrites the secrets of sk (s1, s2 and the seed) with zeros and releases secure memory if used,
+after which sk and its copies cannot be used.
+Copies returned by Bytes, Seed, Encode and so on are not wiped and must be wiped by the caller.
+sk must not be used concurrently, i.e. Destroy must be called after Sign calls with sk return.
+(Sign and Signer.Sign return after all trials using sk have finished.)
+*/
+func (sk *SigningKey) Destroy() {
+	if sk == nil {
+		return
+	}
+	wipePoly(sk.s1, sk.s2)
+	wipe(sk.seed)
+	if sk.mem != nil {
+		sk.mem.free()
+		sk.mem = nil
+	}
+	sk.s1, sk.s2, sk.seed = nil, nil, nil
+}
+
+/*
+Seed returns the seed which sk is derived from, i.e. the smallest serialization of sk,
+which can be restored by NewKeyFromSeed or NewSigningKey.
+It returns nil if sk was not created from a seed (e.g. restored from expanded bytes).
+*/
+func (sk *SigningKey) Seed() []byte {
+	if sk == nil || sk.seed == nil {
+		return nil
+	}
+	return append([]byte(nil), sk.seed...)
+}
+
+/*
+PK is same as PublicKey, but panics if sk is invalid.
+
+Deprecated: Use PublicKey instead.
+*/
 func (sk *SigningKey) PK() *Publickey {
-	pk := &Publickey{}
-	s1 := sk.s1
-	s2 := sk.s2
-	ntt(&s1)
-	ntt(&s2)
-	pk.t = pointwiseMulAdd(constA, s1, s2)
-	invNtt(&pk.t)
-	if err := pk.check(); err != nil {
+	pk, err := sk.PublicKey()
+	if err != nil {
 		panic(err)
 	}
 	return pk
 }
 
-/*Sign signs a message as (z,c) where z is a ring elt in physical form, and c is a hash output encoded as a sparse poly */
-func (sk *SigningKey) Sign(message []byte) (*Signature, error) {
+/*PublicKey takes a signing key stored in physical space and computes the public key in physical space */
+/*points a1, a2 are stored in FFT space */
+func (sk *SigningKey) PublicKey() (*Publickey, error) {
 	if err := sk.check(); err != nil {
 		return nil, err
 	}
-	type result struct {
-		err error
-		sig *Signature
-	}
-	notify := make(chan *result, numcpu.NumCPU())
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	for i := 0; i < numcpu.NumCPU(); i++ {
-		go func() {
-			var y1, y2 [constN]ringelt
-			crand := newCrand()
-			/*sample y1,y2 randomly, and repeat until they pass rejection sampling*/
-			j := 0
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-				}
-				for i := 0; i < constN; i++ {
-					for {
-						y1[i] = ringelt(crand.get16()) /*get 32 bits of random */
-						y1[i] &= ^(^0 << (bBits + 1))  /*take bottom (B_BITS + 1) bits */
-						if y1[i] <= 2*constB+1 {
-							break
-						}
-					}
-					for {
-						y2[i] = ringelt(crand.get16()) /*get 32 bits of random */
-						y2[i] &= ^(^0 << (bBits + 1))  /*take bottom (B_BITS + 1) bits */
-						if y2[i] <= 2*constB+1 {
-							break
-						}
-					}
-					j += 4
-					if y1[i] > constB {
-						y1[i] = constQ - (y1[i] - constB)
-					}
-					if y2[i] > constB {
-						y2[i] = constQ - (y2[i] - constB)
-					}
-				}
-				// sig, err = sk.deterministicSign(y1, y2, message)
-				sig, err := sk.deterministicSign(y1, y2, message)
-				if err == nil {
-					notify <- &result{
-						sig: sig,
-					}
-					return
-				}
-			}
-		}()
+	params := sk.Params()
+	pk := &Publickey{
+		params: params,
 	}
-	select {
-	case r := <-notify:
-		if r.err != nil {
-			return nil, r.err
+	s1 := append([]ringelt(nil), sk.s1...)
+	s2 := append([]ringelt(nil), sk.s2...)
+	params.ntt(s1)
+	params.ntt(s2)
+	pk.t = params.ctPointwiseMulAdd(params.a, s1, s2)
+	wipePoly(s1, s2)
+	params.invNtt(pk.t)
+	if err := pk.check(); err != nil {
+		return nil, err
+	}
+	return pk, nil
+}
+
+/*SignMessage signs a message as (z,c) where z is a ring elt in physical form, and c is a hash output encoded as a sparse poly */
+func (sk *SigningKey) SignMessage(message []byte) (*Signature, error) {
+	return sk.SignContext(context.Background(), message)
+}
+
+/*
+Sign signs message with sk and returns the serialized signature, which implements crypto.Signer.
+The signature is in the raw form by Bytes for ParamsCompact for compatibility,
+and in the framed encoding by Encode for other parameter sets, both of which NewSignature accepts.
+If opts.HashFunc() is crypto.Hash(0), message is signed as it is.
+Otherwise message must be a digest by opts.HashFunc() and is signed in pre-hashed mode (HashGLYPH).
+opts can be *SignOptions. If rand is not nil, it is used as a source of randomness
+instead of the one in opts.
+*/
+func (sk *SigningKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	o := &SignOptions{}
+	switch so := opts.(type) {
+	case nil:
+	case *SignOptions:
+		if so != nil {
+			*o = *so
 		}
-		return r.sig, r.sig.check()
-	case <-time.After(time.Minute):
-		return nil, errors.New("timeout while signing")
+	default:
+		o.Hash = opts.HashFunc()
+	}
+	if rand != nil {
+		o.Rand = rand
+	}
+	sig, err := sk.SignWithOptions(context.Background(), message, o)
+	if err != nil {
+		return nil, err
+	}
+	if sig.Params() != ParamsCompact {
+		return sig.Encode(), nil
+	}
+	return sig.Bytes(), nil
+}
+
+//Public returns the public key (*Publickey) of sk, which implements crypto.Signer.
+//It returns nil if sk is invalid.
+func (sk *SigningKey) Public() crypto.PublicKey {
+	pk, err := sk.PublicKey()
+	if err != nil {
+		return nil
 	}
+	return pk
+}
+
+//Equal reports whether sk and x have the same value.
+func (sk *SigningKey) Equal(x crypto.PrivateKey) bool {
+	xx, ok := x.(*SigningKey)
+	if !ok || sk == nil || xx == nil {
+		return sk == nil && xx == nil && ok
+	}
+	a, b := sk.Bytes(), xx.Bytes()
+	defer wipe(a)
+	defer wipe(b)
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+//Equal reports whether pk and x have the same value.
+func (pk *Publickey) Equal(x crypto.PublicKey) bool {
+	xx, ok := x.(*Publickey)
+	if !ok || pk == nil || xx == nil {
+		return pk == nil && xx == nil && ok
+	}
+	return pk.Params() == xx.Params() && equalPoly(pk.t, xx.t)
+}
+
+/*
+SignWithContext signs message with an application context string appContext (at most 255 bytes) for domain separation.
+SignMessage is same as SignWithContext with the empty context.
+*/
+func (sk *SigningKey) SignWithContext(message []byte, appContext string) (*Signature, error) {
+	return sk.SignWithOptions(context.Background(), message, &SignOptions{
+		Context: appContext,
+	})
+}
+
+/*
+SignContext is same as SignMessage, but gives up when ctx is done.
+In that case it returns ctx.Err(), i.e. context.Canceled or context.DeadlineExceeded.
+Signing is done by workers shared among all SignContext calls.
+*/
+func (sk *SigningKey) SignContext(ctx context.Context, message []byte) (*Signature, error) {
+	return sk.SignWithOptions(ctx, message, nil)
+}
+
+//SignWithOptions is same as SignContext, but signs with opts.
+func (sk *SigningKey) SignWithOptions(ctx context.Context, message []byte, opts *SignOptions) (*Signature, error) {
+	return defaultSigner().SignWithOptions(ctx, sk, message, opts)
+}
+
+/*
+signTemp holds temporaries of deterministicSign, which depend on secrets and are wiped before it returns.
+z1 and z2 are moved to the signature if accepted.
+*/
+type signTemp struct {
+	y1fft, y2fft []ringelt
+	ay1y2, u     []ringelt
+	s1c, s2c     []ringelt
+	z1, z2       []ringelt
+	az1tc        []ringelt
+}
+
+func (t *signTemp) wipe() {
+	wipePoly(t.y1fft, t.y2fft, t.ay1y2, t.u, t.s1c, t.s2c, t.z1, t.z2, t.az1tc)
 }
 
 /*signs a message for a fixed choice of ephemeral secret y in physcial space
 returns error according to success or failure in doing so (due to rejection sampling)*/
-func (sk *SigningKey) deterministicSign(y1, y2 [constN]ringelt, message []byte) (*Signature, error) {
-	var signature Signature
-	y1fft := y1
-	y2fft := y2
-	ntt(&y1fft)
-	ntt(&y2fft)
+func (sk *SigningKey) deterministicSign(y1, y2 []ringelt, dom, message []byte) (*Signature, error) {
+	var tmp signTemp
+	return sk.deterministicSignTemp(&tmp, y1, y2, dom, message)
+}
+
+/*deterministicSignTemp is deterministicSign with temporaries kept in tmp.*/
+func (sk *SigningKey) deterministicSignTemp(tmp *signTemp, y1, y2 []ringelt, dom, message []byte) (*Signature, error) {
+	defer tmp.wipe()
+	params := sk.Params()
+	signature := Signature{
+		params: params,
+	}
+	tmp.y1fft = append([]ringelt(nil), y1...)
+	tmp.y2fft = append([]ringelt(nil), y2...)
+	params.ntt(tmp.y1fft)
+	params.ntt(tmp.y2fft)
 
 	/*ay1_y2 = a y1 + y2*/
-	ay1y2 := pointwiseMulAdd(constA, y1fft, y2fft)
-	invNtt(&ay1y2)
+	tmp.ay1y2 = params.ctPointwiseMulAdd(params.a, tmp.y1fft, tmp.y2fft)
+	params.invNtt(tmp.ay1y2)
 
-	ay1y2rounded := ay1y2
-	kfloor(&ay1y2rounded)
+	tmp.u = append([]ringelt(nil), tmp.ay1y2...)
+	params.kfloor(tmp.u)
 
 	/*round and hash u*/
-	hashOutput := hash(ay1y2rounded, message)
+	hashOutput := hash(tmp.u, dom, message)
 
 	var err error
-	signature.c, err = encodeSparse(hashOutput)
+	signature.c, err = params.encodeSparse(hashOutput)
 	if err != nil {
 		return nil, err
 	}
 
 	/*z_1 = y_1 + s_1 c*/
-	signature.z1 = sparseMul(sk.s1, signature.c)
-	signature.z1 = pointwiseAdd(signature.z1, y1)
+	tmp.s1c = params.ctSparseMul(sk.s1, signature.c)
+	tmp.z1 = params.ctPointwiseAdd(tmp.s1c, y1)
 
-	/*rejection sampling on z_1*/
-	for i := 0; i < constN; i++ {
-		if abs(signature.z1[i]) > (constB - omega) {
-			return nil, errors.New("rejected")
-		}
+	/*rejection sampling on z_1, which reveals only whether it is rejected*/
+	if params.ctExceeds(tmp.z1) != 0 {
+		return nil, errRejected
 	}
 
 	/*z_2 = y_2 + s_2 c*/
-	signature.z2 = sparseMul(sk.s2, signature.c)
-	signature.z2 = pointwiseAdd(signature.z2, y2)
+	tmp.s2c = params.ctSparseMul(sk.s2, signature.c)
+	tmp.z2 = params.ctPointwiseAdd(tmp.s2c, y2)
 
 	/*rejection sampling on z_2*/
-	for i := 0; i < constN; i++ {
-		if abs(signature.z2[i]) > constB-omega {
-			return nil, errors.New("rejected")
-		}
+	if params.ctExceeds(tmp.z2) != 0 {
+		return nil, errRejected
 	}
 
 	/*compression of a*z1 - t*c = (a*y1+y2) - z2*/
-	az1tc := pointwiseSub(ay1y2, signature.z2)
+	tmp.az1tc = params.ctPointwiseSub(tmp.ay1y2, tmp.z2)
 
 	/*signature compression*/
-	for i := 0; i < constN; i++ {
-		signature.z2[i], err = compressCoefficient(az1tc[i], signature.z2[i])
-		if err != nil {
-			return nil, err
-		}
+	for i := 0; i < params.n; i++ {
+		tmp.z2[i] = params.ctCompressCoefficient(tmp.az1tc[i], tmp.z2[i])
 	}
 
+	signature.z1, signature.z2 = tmp.z1, tmp.z2
+	tmp.z1, tmp.z2 = nil, nil
 	return &signature, nil
 }
 
 //Verify veriris the signature.
 func (pk *Publickey) Verify(sig *Signature, message []byte) error {
-	for i := 0; i < constN; i++ {
-		if abs(sig.z1[i]) > (constB - omega) {
-			return errors.New("invalid coeeficient")
-		}
-		if abs(sig.z2[i]) > (constB - omega) {
-			return errors.New("invalid coeeficient")
-		}
+	return pk.verify(sig, nil, message)
+}
+
+//VerifyWithContext verifies the signature signed with the application context string appContext.
+func (pk *Publickey) VerifyWithContext(sig *Signature, message []byte, appContext string) error {
+	return pk.VerifyWithOptions(sig, message, &SignOptions{
+		Context: appContext,
+	})
+}
+
+/*
+VerifyWithOptions verifies the signature signed with opts.
+If opts.Hash is not zero, message must be the digest of the message by opts.Hash.
+*/
+func (pk *Publickey) VerifyWithOptions(sig *Signature, message []byte, opts *SignOptions) error {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	dom, err := opts.domain(message)
+	if err != nil {
+		return err
+	}
+	return pk.verify(sig, dom, message)
+}
+
+func (pk *Publickey) verify(sig *Signature, dom, message []byte) error {
+	if err := sig.checkCoefficients(); err != nil {
+		return err
 	}
 	if err := pk.check(); err != nil {
 		return err
@@ -207,26 +376,41 @@ func (pk *Publickey) Verify(sig *Signature, message []byte) error {
 	if err := sig.check(); err != nil {
 		return err
 	}
-	z1 := sig.z1
-	z2 := sig.z2
-	ntt(&z1)
-	ntt(&z2)
-	h := pointwiseMulAdd(constA, z1, z2)
-	invNtt(&h)
-	tc := sparseMul(pk.t, sig.c)
-	h = pointwiseSub(h, tc)
-	kfloor(&h)
-	hashOutput := hash(h, message)
-	ctest, err := encodeSparse(hashOutput)
+	if err := paramsError(pk.Params(), sig.Params()); err != nil {
+		return err
+	}
+	return pk.verifyChecked(sig, dom, message)
+}
+
+/*verifyChecked verifies the signature, assuming pk and sig are already checked.*/
+func (pk *Publickey) verifyChecked(sig *Signature, dom, message []byte) error {
+	return verifyTC(pk.Params().sparseMul(pk.t, sig.c), sig, dom, message)
+}
+
+/*verifyTC verifies the checked signature with tc = t*c.*/
+func verifyTC(tc []ringelt, sig *Signature, dom, message []byte) error {
+	params := sig.Params()
+	/*a z1 + z2 = invNtt(a ntt(z1)) + z2 by linearity, which saves one NTT*/
+	z1 := append([]ringelt(nil), sig.z1...)
+	params.ntt(z1)
+	h := params.pointwiseMul(params.a, z1)
+	params.invNtt(h)
+	h = params.pointwiseAdd(h, sig.z2)
+	h = params.pointwiseSub(h, tc)
+	params.kfloor(h)
+	hashOutput := hash(h, dom, message)
+	ctest, err := params.encodeSparse(hashOutput)
 	if err != nil {
 		return err
 	}
-	for i := 0; i < omega; i++ {
-		if ctest[i].pos != sig.c[i].pos {
-			return errors.New("invalid signature(pos)")
-		}
-		if ctest[i].sign != sig.c[i].sign {
-			return errors.New("invalid signature(sign)")
+	for i := 0; i < params.omega; i++ {
+		if ctest[i] != sig.c[i] {
+			return &CoefficientError{
+				Field: "c",
+				Index: i,
+				Value: sig.c[i].pos,
+				Err:   ErrInvalidSignature,
+			}
 		}
 	}
 	return nil
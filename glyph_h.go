@@ -20,20 +20,16 @@
 
 package glyph
 
-import (
-	"errors"
-	"fmt"
-)
-
 type ringelt uint16
 
-//Global Constants
+//Sizes for the default parameter set (ParamsCompact).
 const (
-	PKSize  = qBits * constN / 8                  //512 bytes
-	SKSize  = 2 * 2 * constN / 8                  //1792 bytes
+	PKSize  = qBits * constN / 8                  //1792 bytes
+	SKSize  = 2 * 2 * constN / 8                  //512 bytes
 	SigSize = ((bBits+1+2)*constN + 11*omega) / 8 //1942 bytes
 )
 
+/*constants of ParamsCompact, which the NewHope NTT tables are made for. See params.go for other sets.*/
 const (
 	glpDigestLength = 32
 
@@ -41,13 +37,6 @@ const (
 	nBits  = 10
 	omega  = 16
 
-	//sk:512 bytes,pk:2048 bytes, sig:2198bytes
-	//4246 bytes
-	// constQ = 59393
-	// constB = 16383
-	// bBits  = 14
-	// qBits  = 16
-
 	//sk:512 bytes,pk:1792 bytes, sig:1942 bytes
 	//3737 bytes
 	constQ = 12289
@@ -56,33 +45,23 @@ const (
 	qBits  = 14
 )
 
-var (
-	zero   [constN]ringelt
-	one    [constN]ringelt
-	mone   [constN]ringelt
-	allK   [constN]ringelt
-	allMK  [constN]ringelt
-	constA [constN]ringelt
-)
-
-func init() {
-	for i := range one {
-		one[i] = 1
-		mone[i] = constQ - 1
-		allK[i] = constB - omega
-		allMK[i] = constQ - (constB - omega)
-	}
-}
+var constA [constN]ringelt
 
 //Publickey of glyph signature.
 type Publickey struct {
-	t [constN]ringelt
+	params *Params
+	t      []ringelt
 }
 
 //SigningKey of glyph signature.
 type SigningKey struct {
-	s1 [constN]ringelt
-	s2 [constN]ringelt
+	params *Params
+	s1     []ringelt
+	s2     []ringelt
+	/*seed which s1,s2 are derived from, or nil*/
+	seed []byte
+	/*mem is non-nil if s1, s2 and seed are stored in secure memory*/
+	mem *secureMem
 }
 
 type sparsePoly struct {
@@ -90,60 +69,129 @@ type sparsePoly struct {
 	sign bool
 }
 
-type sparsePolyST [omega]sparsePoly
+type sparsePolyST []sparsePoly
 
 //Signature of glyph signature.
 type Signature struct {
-	z1 [constN]ringelt
-	z2 [constN]ringelt
-	c  *sparsePolyST
+	params *Params
+	z1     []ringelt
+	z2     []ringelt
+	c      sparsePolyST
+}
+
+func paramsOrDefault(p *Params) *Params {
+	if p == nil {
+		return ParamsCompact
+	}
+	return p
+}
+
+//Params returns the parameter set of the public key.
+func (p *Publickey) Params() *Params {
+	if p == nil {
+		return ParamsCompact
+	}
+	return paramsOrDefault(p.params)
+}
+
+//Params returns the parameter set of the signing key.
+func (s *SigningKey) Params() *Params {
+	if s == nil {
+		return ParamsCompact
+	}
+	return paramsOrDefault(s.params)
+}
+
+//Params returns the parameter set of the signature.
+func (sig *Signature) Params() *Params {
+	if sig == nil {
+		return ParamsCompact
+	}
+	return paramsOrDefault(sig.params)
+}
+
+/*isConst returns true if all coefficients of v are c.*/
+func isConst(v []ringelt, c ringelt) bool {
+	for _, x := range v {
+		if x != c {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPoly(a, b []ringelt) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (p *Publickey) check() error {
-	if p.t == zero || p.t == one {
-		return errors.New("invalid t")
+	if p == nil {
+		return &CoefficientError{Field: "t", Index: -1, Err: ErrInvalidPublicKey}
+	}
+	params := p.Params()
+	if len(p.t) != params.n || isConst(p.t, 0) || isConst(p.t, 1) {
+		return &CoefficientError{Field: "t", Index: -1, Err: ErrInvalidPublicKey}
 	}
-	for _, t := range p.t {
-		if t >= constQ {
-			return errors.New("invalid t")
+	for i, t := range p.t {
+		if t >= params.q {
+			return &CoefficientError{Field: "t", Index: i, Value: uint16(t), Err: ErrInvalidPublicKey}
 		}
 	}
 	return nil
 }
 func (s *SigningKey) check() error {
-	if s.s1 == zero || s.s1 == one {
-		return errors.New("invalid s1, all zero or one")
+	if s == nil {
+		return &CoefficientError{Field: "s1", Index: -1, Err: ErrInvalidSigningKey}
 	}
-	if s.s2 == zero || s.s2 == one {
-		return errors.New("invalid s2,all zero or one")
+	params := s.Params()
+	if len(s.s1) != params.n || ctIsConst(s.s1, 0) || ctIsConst(s.s1, 1) {
+		return &CoefficientError{Field: "s1", Index: -1, Err: ErrInvalidSigningKey}
 	}
-	for i := range s.s1 {
-		if s.s1[i] != 0 && s.s1[i] != 1 && s.s1[i] != constQ-1 {
-			return fmt.Errorf("invalid s1,%v is not 0,1,-1", s.s1[i])
-		}
-		if s.s2[i] != 0 && s.s2[i] != 1 && s.s2[i] != constQ-1 {
-			return fmt.Errorf("invalid s2,%v is not 0,1,-1", s.s2[i])
-		}
+	if len(s.s2) != params.n || ctIsConst(s.s2, 0) || ctIsConst(s.s2, 1) {
+		return &CoefficientError{Field: "s2", Index: -1, Err: ErrInvalidSigningKey}
+	}
+	/*neither the index nor the value of an invalid coefficient is reported, because they are secrets*/
+	if params.ctInvalidSecret(s.s1) != 0 {
+		return &CoefficientError{Field: "s1", Index: -1, Err: ErrInvalidSigningKey}
+	}
+	if params.ctInvalidSecret(s.s2) != 0 {
+		return &CoefficientError{Field: "s2", Index: -1, Err: ErrInvalidSigningKey}
 	}
 	return nil
 }
 
 func (sig *Signature) check() error {
-	if sig.z1 == zero || sig.z1 == mone {
-		return errors.New("invalid z1")
+	if err := sig.checkLength(); err != nil {
+		return err
+	}
+	params := sig.Params()
+	k := params.k()
+	if isConst(sig.z1, 0) || isConst(sig.z1, params.q-1) {
+		return &CoefficientError{Field: "z1", Index: -1, Err: ErrMalformedSignature}
 	}
-	if sig.z2 == zero || sig.z2 == allK || sig.z2 == allMK {
-		return errors.New("invalid z2")
+	if isConst(sig.z2, 0) || isConst(sig.z2, k) || isConst(sig.z2, params.q-k) {
+		return &CoefficientError{Field: "z2", Index: -1, Err: ErrMalformedSignature}
 	}
-	for _, z2 := range sig.z2 {
-		if z2 != 0 && z2 != constB-omega && z2 != constQ-(constB-omega) {
-			return errors.New("invalid z2")
+	for i, z2 := range sig.z2 {
+		if z2 != 0 && z2 != k && z2 != params.q-k {
+			return &CoefficientError{Field: "z2", Index: i, Value: uint16(z2), Err: ErrMalformedSignature}
 		}
 	}
 	pos := make(map[uint16]struct{})
-	for _, s := range sig.c {
+	for i, s := range sig.c {
+		if s.pos >= uint16(params.n) {
+			return &CoefficientError{Field: "c", Index: i, Value: s.pos, Err: ErrMalformedSignature}
+		}
 		if _, exist := pos[s.pos]; exist {
-			return errors.New("invalid pos")
+			return &CoefficientError{Field: "c", Index: i, Value: s.pos, Err: ErrMalformedSignature}
 		}
 		pos[s.pos] = struct{}{}
 	}
@@ -161,41 +209,76 @@ func (sig *Signature) check() error {
 	return nil
 }
 
-func sign(x ringelt) int {
+/*checkLength checks that the lengths of fields of sig match its parameter set.*/
+func (sig *Signature) checkLength() error {
+	if sig == nil || sig.c == nil {
+		return &CoefficientError{Field: "c", Index: -1, Err: ErrMalformedSignature}
+	}
+	params := sig.Params()
+	if len(sig.c) != params.omega {
+		return &CoefficientError{Field: "c", Index: -1, Err: ErrMalformedSignature}
+	}
+	if len(sig.z1) != params.n {
+		return &CoefficientError{Field: "z1", Index: -1, Err: ErrMalformedSignature}
+	}
+	if len(sig.z2) != params.n {
+		return &CoefficientError{Field: "z2", Index: -1, Err: ErrMalformedSignature}
+	}
+	return nil
+}
+
+func (sig *Signature) checkCoefficients() error {
+	if err := sig.checkLength(); err != nil {
+		return err
+	}
+	params := sig.Params()
+	k := params.k()
+	for i := 0; i < params.n; i++ {
+		if params.abs(sig.z1[i]) > k {
+			return &CoefficientError{Field: "z1", Index: i, Value: uint16(sig.z1[i]), Err: ErrMalformedSignature}
+		}
+		if params.abs(sig.z2[i]) > k {
+			return &CoefficientError{Field: "z2", Index: i, Value: uint16(sig.z2[i]), Err: ErrMalformedSignature}
+		}
+	}
+	return nil
+}
+
+func (p *Params) sign(x ringelt) int {
 	if x == 0 {
 		return 0
 	}
-	if 2*x <= constQ {
+	if 2*uint32(x) <= uint32(p.q) {
 		return 1
 	}
 	return -1
 }
 
-func abs(x ringelt) ringelt {
-	if 2*uint32(x) <= constQ {
+func (p *Params) abs(x ringelt) ringelt {
+	if 2*uint32(x) <= uint32(p.q) {
 		return x
 	}
-	return constQ - x
+	return p.q - x
 }
 
-func addMOD(a, b ringelt) ringelt {
+func (p *Params) addMOD(a, b ringelt) ringelt {
 	x := uint32(a) + uint32(b)
-	if x >= constQ {
-		x -= constQ
+	if x >= uint32(p.q) {
+		x -= uint32(p.q)
 	}
 	return ringelt(x)
 }
 
-func subMOD(a, b ringelt) ringelt {
-	x := uint32(a) + uint32(constQ-b)
-	if x >= constQ {
-		x -= constQ
+func (p *Params) subMOD(a, b ringelt) ringelt {
+	x := uint32(a) + uint32(p.q-b)
+	if x >= uint32(p.q) {
+		x -= uint32(p.q)
 	}
 	return ringelt(x)
 }
 
-func mulMOD(a, b ringelt) ringelt {
-	return ringelt((uint32(a) * uint32(b)) % constQ)
+func (p *Params) mulMOD(a, b ringelt) ringelt {
+	return ringelt((uint32(a) * uint32(b)) % uint32(p.q))
 }
 
 // func subMODn(a, b ringelt) ringelt {
@@ -206,29 +289,39 @@ func mulMOD(a, b ringelt) ringelt {
 // 	return ringelt(x)
 // }
 
-func pointwiseAdd(b, e0 [constN]ringelt) [constN]ringelt {
-	var v [constN]ringelt
-	for i := 0; i < constN; i++ {
-		v[i] = addMOD(e0[i], b[i])
+func (p *Params) pointwiseAdd(b, e0 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.addMOD(e0[i], b[i])
+	}
+	return v
+}
+
+func (p *Params) pointwiseSub(b, e0 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.subMOD(b[i], e0[i])
 	}
 	return v
 }
 
-func pointwiseSub(b, e0 [constN]ringelt) [constN]ringelt {
-	var v [constN]ringelt
-	for i := 0; i < constN; i++ {
-		v[i] = subMOD(b[i], e0[i])
+/* Pointwise multiplication in the ring.
+   All done in the FFT / CRT domain. */
+func (p *Params) pointwiseMul(b, e0 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.mulMOD(e0[i], b[i])
 	}
 	return v
 }
 
 /* Pointwise multiplication and addition in the ring.
    All done in the FFT / CRT domain. */
-func pointwiseMulAdd(b, e0, e1 [constN]ringelt) [constN]ringelt {
-	var v [constN]ringelt
-	for i := 0; i < constN; i++ {
-		v[i] = mulMOD(e0[i], b[i])
-		v[i] = addMOD(v[i], e1[i])
+func (p *Params) pointwiseMulAdd(b, e0, e1 []ringelt) []ringelt {
+	v := p.newPoly()
+	for i := 0; i < p.n; i++ {
+		v[i] = p.mulMOD(e0[i], b[i])
+		v[i] = p.addMOD(v[i], e1[i])
 	}
 	return v
 }
@@ -0,0 +1,248 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Hierarchical deterministic derivation of signing keys, similar to SLIP-0010 for ed25519.
+A child key is derived only from the parent's seed and chain code; there is no derivation
+of public keys, so the hardened bit of an index just makes it another index.
+*/
+
+//HardenedKeyStart is the first index of hardened keys (written as i' in paths).
+const HardenedKeyStart uint32 = 0x80000000
+
+//ExtendedKeySize is the size of serialized ExtendedKey.
+const ExtendedKeySize = 4 + 1 + 4 + 4 + 32 + SeedSize
+
+var (
+	hdMasterKey        = []byte("GLYPH seed")
+	extendedKeyVersion = [4]byte{'G', 'L', 'H', 'D'}
+)
+
+//ExtendedKey is a seed of a signing key with a chain code for deriving child keys.
+type ExtendedKey struct {
+	seed              [SeedSize]byte
+	chainCode         [32]byte
+	depth             byte
+	parentFingerprint [4]byte
+	index             uint32
+	destroyed         bool
+}
+
+/*
+NewMasterKey derives the master extended key from a master seed,
+which must be 16 to 64 bytes.
+*/
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, lengthError("master seed", len(seed))
+	}
+	k := &ExtendedKey{}
+	k.set(hdMasterKey, seed)
+	return k, nil
+}
+
+func (k *ExtendedKey) set(key, data []byte) {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	i := mac.Sum(nil)
+	copy(k.seed[:], i[:SeedSize])
+	copy(k.chainCode[:], i[SeedSize:])
+	wipe(i)
+}
+
+//Child derives the i-th child extended key of k.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if k.depth == 255 {
+		return nil, fmt.Errorf("%w: too deep derivation", ErrInvalidOptions)
+	}
+	fp, err := k.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 1+SeedSize+4)
+	copy(data[1:], k.seed[:])
+	binary.BigEndian.PutUint32(data[1+SeedSize:], i)
+	c := &ExtendedKey{
+		depth: k.depth + 1,
+		index: i,
+	}
+	copy(c.parentFingerprint[:], fp)
+	c.set(k.chainCode[:], data)
+	wipe(data)
+	return c, nil
+}
+
+/*
+Derive derives the extended key along path from k, which must be the master key.
+path is like "m/44'/0'/0'/1", where ' (or h) means a hardened index.
+*/
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	if k.depth != 0 {
+		return nil, fmt.Errorf("%w: path must be derived from the master key", ErrInvalidOptions)
+	}
+	indices, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	parent := k
+	for _, i := range indices {
+		c, err := parent.Child(i)
+		if parent != k {
+			parent.Destroy()
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent = c
+	}
+	if parent == k {
+		/*a copy so that k and the result can be destroyed independently*/
+		c := *k
+		return &c, nil
+	}
+	return parent, nil
+}
+
+//ParsePath parses a derivation path like "m/44'/0'/0'/1" into indices.
+func ParsePath(path string) ([]uint32, error) {
+	elems := strings.Split(path, "/")
+	if elems[0] != "m" {
+		return nil, fmt.Errorf("%w: path must start with m", ErrInvalidFormat)
+	}
+	indices := make([]uint32, 0, len(elems)-1)
+	for _, e := range elems[1:] {
+		var h uint32
+		if strings.HasSuffix(e, "'") || strings.HasSuffix(e, "h") {
+			h = HardenedKeyStart
+			e = e[:len(e)-1]
+		}
+		i, err := strconv.ParseUint(e, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid index in path: %q", ErrInvalidFormat, e)
+		}
+		indices = append(indices, uint32(i)+h)
+	}
+	return indices, nil
+}
+
+//SigningKey returns the signing key of k of ParamsCompact.
+func (k *ExtendedKey) SigningKey() (*SigningKey, error) {
+	return k.SigningKeyWithParams(ParamsCompact)
+}
+
+//SigningKeyWithParams returns the signing key of k of the parameter set params.
+func (k *ExtendedKey) SigningKeyWithParams(params *Params) (*SigningKey, error) {
+	if k.destroyed {
+		return nil, fmt.Errorf("%w: extended key is destroyed", ErrInvalidSigningKey)
+	}
+	return params.NewKeyFromSeed(k.seed[:])
+}
+
+//Fingerprint returns the first 4 bytes of the hash of the public key of k.
+func (k *ExtendedKey) Fingerprint() ([]byte, error) {
+	sk, err := k.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	defer sk.Destroy()
+	return sk.Fingerprint()
+}
+
+//Depth returns the depth of k, which is 0 for the master key.
+func (k *ExtendedKey) Depth() int {
+	return int(k.depth)
+}
+
+//Index returns the index of k in its parent.
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
+
+//ChainCode returns the chain code of k.
+func (k *ExtendedKey) ChainCode() []byte {
+	c := make([]byte, len(k.chainCode))
+	copy(c, k.chainCode[:])
+	return c
+}
+
+//Bytes serializes k as version || depth || parent fingerprint || index || chain code || seed.
+func (k *ExtendedKey) Bytes() []byte {
+	b := make([]byte, 0, ExtendedKeySize)
+	b = append(b, extendedKeyVersion[:]...)
+	b = append(b, k.depth)
+	b = append(b, k.parentFingerprint[:]...)
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], k.index)
+	b = append(b, idx[:]...)
+	b = append(b, k.chainCode[:]...)
+	return append(b, k.seed[:]...)
+}
+
+//NewExtendedKey restores an extended key serialized by Bytes.
+func NewExtendedKey(b []byte) (*ExtendedKey, error) {
+	if len(b) != ExtendedKeySize {
+		return nil, lengthError("extended key", len(b))
+	}
+	if !hmac.Equal(b[:4], extendedKeyVersion[:]) {
+		return nil, fmt.Errorf("%w: invalid version of extended key", ErrInvalidFormat)
+	}
+	k := &ExtendedKey{
+		depth: b[4],
+		index: binary.BigEndian.Uint32(b[9:]),
+	}
+	copy(k.parentFingerprint[:], b[5:9])
+	copy(k.chainCode[:], b[13:])
+	copy(k.seed[:], b[13+32:])
+	if k.depth == 0 && (k.index != 0 || k.parentFingerprint != [4]byte{}) {
+		k.Destroy()
+		return nil, fmt.Errorf("%w: invalid master key", ErrInvalidFormat)
+	}
+	sk, err := k.SigningKey()
+	if err != nil {
+		k.Destroy()
+		return nil, err
+	}
+	sk.Destroy()
+	return k, nil
+}
+
+/*
+Destroy overwrites the seed and the chain code of k with zeros,
+after which k cannot derive keys. Copies returned by Bytes and ChainCode must be wiped by the caller.
+*/
+func (k *ExtendedKey) Destroy() {
+	if k == nil {
+		return
+	}
+	wipe(k.seed[:])
+	wipe(k.chainCode[:])
+	k.destroyed = true
+}
@@ -174,13 +174,15 @@ func nttSub(a *[constN]ringelt, omega *[constN / 2]ringelt) {
 	}
 }
 
-func ntt(p *[constN]ringelt) {
+func ntt(f []ringelt) {
+	p := (*[constN]ringelt)(f)
 	bitrev(p)
 	mulCoefficients(p, &psisBitrevMontgomery)
 	nttSub(p, &omegasMontgomery)
 }
 
-func invNtt(p *[constN]ringelt) {
+func invNtt(f []ringelt) {
+	p := (*[constN]ringelt)(f)
 	bitrev(p)
 	nttSub(p, &omegasInvMontgomery)
 	mulCoefficients(p, &psisInvMontgomery)
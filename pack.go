@@ -0,0 +1,76 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+/*
+Serialized keys and signatures are big-endian representations of integers,
+where coefficients are packed from the least significant bit.
+bitWriter and bitReader pack and unpack them from the last byte without big.Int.
+*/
+
+type bitWriter struct {
+	b    []byte
+	pos  int
+	acc  uint64
+	nacc uint
+}
+
+/*write packs the lowest bits of v.*/
+func (w *bitWriter) write(v uint32, bits uint) {
+	w.acc |= uint64(v&(1<<bits-1)) << w.nacc
+	w.nacc += bits
+	for w.nacc >= 8 {
+		w.pos++
+		w.b[len(w.b)-w.pos] = byte(w.acc)
+		w.acc >>= 8
+		w.nacc -= 8
+	}
+}
+
+/*flush writes remaining bits.*/
+func (w *bitWriter) flush() {
+	if w.nacc > 0 {
+		w.pos++
+		w.b[len(w.b)-w.pos] = byte(w.acc)
+		w.acc = 0
+		w.nacc = 0
+	}
+}
+
+type bitReader struct {
+	b    []byte
+	pos  int
+	acc  uint64
+	nacc uint
+}
+
+/*read unpacks bits bits.*/
+func (r *bitReader) read(bits uint) uint32 {
+	for r.nacc < bits {
+		r.pos++
+		r.acc |= uint64(r.b[len(r.b)-r.pos]) << r.nacc
+		r.nacc += 8
+	}
+	v := uint32(r.acc & (1<<bits - 1))
+	r.acc >>= bits
+	r.nacc -= bits
+	return v
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Params is a parameter set of GLYPH signature.
+Keys and signatures carry the parameter set they are made with,
+and ones of different parameter sets cannot be used together.
+*/
+type Params struct {
+	name  string
+	/*id identifies the parameter set in the framed encoding*/
+	id    byte
+	n     int
+	nBits uint
+	omega int
+	q     ringelt
+	b     ringelt
+	bBits uint
+	qBits uint
+	/*a is the public constant polynomial a, stored in NTT domain*/
+	a []ringelt
+	/*zetas[k] = psi^bitrev(k), where psi is a primitive 2n-th root of unity, or nil if the NewHope NTT is used*/
+	zetas []ringelt
+	nInv  ringelt
+	/*barrett = floor(2^32/Q) and kDiv = floor(2^32/(2K+1))+1 for constant-time reduction and division*/
+	barrett uint64
+	kDiv    uint64
+}
+
+//Parameter sets.
+var (
+	/*
+		ParamsCompact is the parameter set of this package (n=1024, Q=12289, B=4095),
+		which has smaller keys and signatures than the original one.
+		It is the default parameter set.
+	*/
+	ParamsCompact = &Params{
+		name:  "GLYPH-1024-12289",
+		id:    1,
+		n:     constN,
+		nBits: nBits,
+		omega: omega,
+		q:     constQ,
+		b:     constB,
+		bBits: bBits,
+		qBits: qBits,
+		a:     constA[:],
+	}
+	//ParamsOriginal has n, Q, B and omega of the parameter set in the GLYPH paper (n=1024, Q=59393, B=16383).
+	//The constant a is derived from the name of the parameter set, not the one in the paper,
+	//so keys and signatures are not interoperable with other implementations of the paper.
+	ParamsOriginal = newParams("GLYPH-1024-59393", 2, 1024, 10, 16, 59393, 16383, 14, 16)
+	//ParamsHigh is the parameter set with higher security level (n=2048, Q=61441, B=16383).
+	ParamsHigh = newParams("GLYPH-2048-61441", 3, 2048, 11, 16, 61441, 16383, 14, 16)
+)
+
+var paramSets = []*Params{ParamsCompact, ParamsOriginal, ParamsHigh}
+
+func init() {
+	ParamsCompact.initReduction()
+}
+
+/*
+newParams returns a parameter set with n=2^nBits and a prime q with q = 1 mod 2n.
+The constant a is derived from the name, and a generic negacyclic NTT is used.
+*/
+func newParams(name string, id byte, n int, nBits uint, omega int, q, b ringelt, bBits, qBits uint) *Params {
+	p := &Params{
+		name:  name,
+		id:    id,
+		n:     n,
+		nBits: nBits,
+		omega: omega,
+		q:     q,
+		b:     b,
+		bBits: bBits,
+		qBits: qBits,
+	}
+	/*compression of z2 works only if Q-K is in the last interval of kfloor*/
+	d := 2*p.k() + 1
+	if p.q-p.k() < (p.q-1)/d*d {
+		panic("glyph: invalid parameter set " + name)
+	}
+	p.initReduction()
+	p.initNTT()
+	p.initA()
+	return p
+}
+
+//ParamsByName returns the parameter set named name.
+func ParamsByName(name string) (*Params, error) {
+	for _, p := range paramSets {
+		if p.name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownParams, name)
+}
+
+func paramsByID(id byte) (*Params, error) {
+	for _, p := range paramSets {
+		if p.id == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: id %d", ErrUnknownParams, id)
+}
+
+//Name returns the name of the parameter set.
+func (p *Params) Name() string {
+	return p.name
+}
+
+func (p *Params) String() string {
+	return p.name
+}
+
+//N returns the degree of polynomials.
+func (p *Params) N() int {
+	return p.n
+}
+
+//Q returns the modulus.
+func (p *Params) Q() int {
+	return int(p.q)
+}
+
+//B returns the bound of coefficients of ephemeral secrets.
+func (p *Params) B() int {
+	return int(p.b)
+}
+
+//Omega returns the number of non-zero coefficients of the hash output c.
+func (p *Params) Omega() int {
+	return p.omega
+}
+
+//PKSize returns the size of a serialized public key.
+func (p *Params) PKSize() int {
+	return int(p.qBits) * p.n / 8
+}
+
+//SKSize returns the size of a serialized signing key.
+func (p *Params) SKSize() int {
+	return 2 * 2 * p.n / 8
+}
+
+//SigSize returns the size of a serialized signature.
+func (p *Params) SigSize() int {
+	return (int(p.bBits+1+2)*p.n + int(p.nBits+1)*p.omega) / 8
+}
+
+/*k returns K = B - omega, the bound of coefficients of z1 and z2.*/
+func (p *Params) k() ringelt {
+	return p.b - ringelt(p.omega)
+}
+
+func (p *Params) newPoly() []ringelt {
+	return make([]ringelt, p.n)
+}
+
+func (p *Params) powMOD(x ringelt, e int) ringelt {
+	r := ringelt(1)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r = p.mulMOD(r, x)
+		}
+		x = p.mulMOD(x, x)
+	}
+	return r
+}
+
+/*initNTT computes the table of twiddle factors from a primitive 2n-th root of unity.*/
+func (p *Params) initNTT() {
+	var psi ringelt
+	for g := ringelt(2); g < p.q; g++ {
+		psi = p.powMOD(g, int(p.q-1)/(2*p.n))
+		if p.powMOD(psi, p.n) == p.q-1 {
+			break
+		}
+	}
+	p.zetas = p.newPoly()
+	for k := range p.zetas {
+		var r int
+		for i := uint(0); i < p.nBits; i++ {
+			r |= (k >> i & 1) << (p.nBits - 1 - i)
+		}
+		p.zetas[k] = p.powMOD(psi, r)
+	}
+	p.nInv = p.powMOD(ringelt(p.n), int(p.q)-2)
+}
+
+/*initA samples a uniformly in NTT domain from the stream keyed by the hash of the name.*/
+func (p *Params) initA() {
+	key := sha256.Sum256([]byte("GLYPH constant a " + p.name))
+	r, err := newRandom(key[:], make([]byte, aes.BlockSize))
+	if err != nil {
+		panic(err)
+	}
+	p.a = p.newPoly()
+	var b [2]byte
+	for i := range p.a {
+		for {
+			r.Read(b[:])
+			v := ringelt(binary.LittleEndian.Uint16(b[:])) & (1<<p.qBits - 1)
+			if v < p.q {
+				p.a[i] = v
+				break
+			}
+		}
+	}
+}
+
+/*ntt transforms f into NTT domain in place in constant time.*/
+func (p *Params) ntt(f []ringelt) {
+	if p.zetas == nil {
+		ntt(f)
+		return
+	}
+	k := 0
+	for l := p.n / 2; l > 0; l >>= 1 {
+		for start := 0; start < p.n; start += 2 * l {
+			k++
+			z := p.zetas[k]
+			for j := start; j < start+l; j++ {
+				t := p.ctMulMOD(z, f[j+l])
+				f[j+l] = p.ctSubMOD(f[j], t)
+				f[j] = p.ctAddMOD(f[j], t)
+			}
+		}
+	}
+}
+
+/*invNtt transforms f from NTT domain in place in constant time.*/
+func (p *Params) invNtt(f []ringelt) {
+	if p.zetas == nil {
+		invNtt(f)
+		return
+	}
+	k := p.n
+	for l := 1; l < p.n; l <<= 1 {
+		for start := 0; start < p.n; start += 2 * l {
+			k--
+			z := p.zetas[k]
+			for j := start; j < start+l; j++ {
+				t := f[j]
+				f[j] = p.ctAddMOD(t, f[j+l])
+				f[j+l] = p.ctMulMOD(z, p.ctSubMOD(f[j+l], t))
+			}
+		}
+	}
+	for i := range f {
+		f[i] = p.ctMulMOD(f[i], p.nInv)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+)
+
+/*
+OIDGlyph is the arc of algorithm identifiers of GLYPH, which is followed by the id of a parameter set
+(e.g. OIDGlyph.1 for ParamsCompact).
+
+It is PROVISIONAL: it is placed under the IANA experimental arc (1.3.6.1.3) after the paper
+(IACR ePrint 2017/766) without any assignment, so it may collide with OIDs of other experiments.
+Keys in PKIX/PKCS #8 and PEM by this package are not interoperable with other implementations,
+and the OID will be replaced when an owned arc is assigned.
+*/
+var OIDGlyph = asn1.ObjectIdentifier{1, 3, 6, 1, 3, 2017, 766}
+
+//PEM block types.
+const (
+	PEMPublicKeyType  = "GLYPH PUBLIC KEY"
+	PEMPrivateKeyType = "GLYPH PRIVATE KEY"
+)
+
+//OID returns the algorithm identifier of the parameter set.
+func (p *Params) OID() asn1.ObjectIdentifier {
+	oid := append(asn1.ObjectIdentifier(nil), OIDGlyph...)
+	return append(oid, int(p.id))
+}
+
+func paramsByOID(oid asn1.ObjectIdentifier) (*Params, error) {
+	for _, p := range paramSets {
+		if p.OID().Equal(oid) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: OID %v", ErrUnknownParams, oid)
+}
+
+/*subjectPublicKeyInfo is same as the one in RFC 5280.*/
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+/*oneAsymmetricKey is same as the one in RFC 5958 without optional fields.*/
+type oneAsymmetricKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+func unmarshalDER(der []byte, v interface{}) error {
+	rest, err := asn1.Unmarshal(der, v)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: trailing data after ASN.1", ErrInvalidFormat)
+	}
+	return nil
+}
+
+//MarshalPKIXPublicKey converts pk to DER-encoded SubjectPublicKeyInfo with the raw form of pk.
+func MarshalPKIXPublicKey(pk *Publickey) ([]byte, error) {
+	if err := pk.check(); err != nil {
+		return nil, err
+	}
+	b := pk.Bytes()
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: pk.Params().OID(),
+		},
+		PublicKey: asn1.BitString{
+			Bytes:     b,
+			BitLength: 8 * len(b),
+		},
+	})
+}
+
+//ParsePKIXPublicKey parses a public key in DER-encoded SubjectPublicKeyInfo.
+func ParsePKIXPublicKey(der []byte) (*Publickey, error) {
+	var spki subjectPublicKeyInfo
+	if err := unmarshalDER(der, &spki); err != nil {
+		return nil, err
+	}
+	params, err := paramsByOID(spki.Algorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if spki.PublicKey.BitLength != 8*len(spki.PublicKey.Bytes) {
+		return nil, fmt.Errorf("%w: invalid length of the bit string", ErrInvalidFormat)
+	}
+	/*only the raw form, whose parameter set is the one by the OID*/
+	if len(spki.PublicKey.Bytes) != params.PKSize() {
+		return nil, fmt.Errorf("%w: public key is not in the raw form of %v", ErrInvalidFormat, params)
+	}
+	return params.newPublickey(spki.PublicKey.Bytes)
+}
+
+/*
+MarshalPKCS8PrivateKey converts sk to DER-encoded PKCS #8 (OneAsymmetricKey),
+where the private key is an OCTET STRING of the seed of sk if it has, or of the expanded form otherwise.
+*/
+func MarshalPKCS8PrivateKey(sk *SigningKey) ([]byte, error) {
+	if err := sk.check(); err != nil {
+		return nil, err
+	}
+	b := sk.Seed()
+	if b == nil {
+		b = sk.Bytes()
+	}
+	defer wipe(b)
+	key, err := asn1.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+	return asn1.Marshal(oneAsymmetricKey{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: sk.Params().OID(),
+		},
+		PrivateKey: key,
+	})
+}
+
+//ParsePKCS8PrivateKey parses a signing key in DER-encoded PKCS #8.
+func ParsePKCS8PrivateKey(der []byte) (*SigningKey, error) {
+	var p8 oneAsymmetricKey
+	defer func() { wipe(p8.PrivateKey) }()
+	if err := unmarshalDER(der, &p8); err != nil {
+		return nil, err
+	}
+	if p8.Version != 0 {
+		return nil, fmt.Errorf("%w: unknown PKCS #8 version %d", ErrInvalidFormat, p8.Version)
+	}
+	params, err := paramsByOID(p8.Algorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	defer func() { wipe(key) }()
+	if err := unmarshalDER(p8.PrivateKey, &key); err != nil {
+		return nil, err
+	}
+	/*only the seed or the expanded form, whose parameter set is the one by the OID*/
+	if len(key) != SeedSize && len(key) != params.SKSize() {
+		return nil, fmt.Errorf("%w: private key is neither the seed nor the expanded form of %v", ErrInvalidFormat, params)
+	}
+	sk, err := params.newSigningKey(key)
+	if err != nil {
+		sk.Destroy()
+		return nil, err
+	}
+	return sk, nil
+}
+
+//MarshalPublicKeyPEM converts pk to a PEM block of PEMPublicKeyType with SubjectPublicKeyInfo.
+func MarshalPublicKeyPEM(pk *Publickey) ([]byte, error) {
+	der, err := MarshalPKIXPublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  PEMPublicKeyType,
+		Bytes: der,
+	}), nil
+}
+
+//ParsePublicKeyPEM parses the first PEM block in b, which must be of PEMPublicKeyType.
+func ParsePublicKeyPEM(b []byte) (*Publickey, error) {
+	der, err := decodePEM(b, PEMPublicKeyType)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKIXPublicKey(der)
+}
+
+//MarshalPrivateKeyPEM converts sk to a PEM block of PEMPrivateKeyType with PKCS #8.
+func MarshalPrivateKeyPEM(sk *SigningKey) ([]byte, error) {
+	der, err := MarshalPKCS8PrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(der)
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  PEMPrivateKeyType,
+		Bytes: der,
+	}), nil
+}
+
+//ParsePrivateKeyPEM parses the first PEM block in b, which must be of PEMPrivateKeyType.
+func ParsePrivateKeyPEM(b []byte) (*SigningKey, error) {
+	der, err := decodePEM(b, PEMPrivateKeyType)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(der)
+	return ParsePKCS8PrivateKey(der)
+}
+
+func decodePEM(b []byte, typ string) ([]byte, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block", ErrInvalidFormat)
+	}
+	if block.Type != typ {
+		return nil, fmt.Errorf("%w: PEM type %q is not %q", ErrInvalidFormat, block.Type, typ)
+	}
+	return block.Bytes, nil
+}
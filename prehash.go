@@ -0,0 +1,104 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"context"
+	"crypto"
+	stdhash "hash"
+	"io"
+)
+
+/*
+Prehash is a hash.Hash for signing and verifying in pre-hashed mode (HashGLYPH).
+Write the message to it, and then pass it to SignPrehash or VerifyPrehash,
+so that a large message streams through constant memory.
+*/
+type Prehash struct {
+	stdhash.Hash
+	h crypto.Hash
+}
+
+//NewPrehash returns a Prehash which digests messages with h.
+func NewPrehash(h crypto.Hash) (*Prehash, error) {
+	if h == crypto.Hash(0) || !h.Available() {
+		return nil, optionsError("unavailable hash function")
+	}
+	return &Prehash{
+		Hash: h.New(),
+		h:    h,
+	}, nil
+}
+
+//HashFunc returns the hash function of p.
+func (p *Prehash) HashFunc() crypto.Hash {
+	return p.h
+}
+
+//SignPrehash signs the message written to p in pre-hashed mode.
+func (sk *SigningKey) SignPrehash(ctx context.Context, p *Prehash) (*Signature, error) {
+	if p == nil || p.Hash == nil {
+		return nil, optionsError("nil Prehash")
+	}
+	return sk.SignWithOptions(ctx, p.Sum(nil), &SignOptions{
+		Hash: p.h,
+	})
+}
+
+//VerifyPrehash verifies the signature of the message written to p in pre-hashed mode.
+func (pk *Publickey) VerifyPrehash(sig *Signature, p *Prehash) error {
+	if p == nil || p.Hash == nil {
+		return optionsError("nil Prehash")
+	}
+	return pk.VerifyWithOptions(sig, p.Sum(nil), &SignOptions{
+		Hash: p.h,
+	})
+}
+
+//SignReader signs the message read from r in pre-hashed mode with the hash function h.
+func (sk *SigningKey) SignReader(ctx context.Context, r io.Reader, h crypto.Hash) (*Signature, error) {
+	p, err := NewPrehash(h)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, optionsError("nil reader")
+	}
+	if _, err := io.Copy(p, r); err != nil {
+		return nil, err
+	}
+	return sk.SignPrehash(ctx, p)
+}
+
+//VerifyReader verifies the signature of the message read from r in pre-hashed mode with the hash function h.
+func (pk *Publickey) VerifyReader(sig *Signature, r io.Reader, h crypto.Hash) error {
+	p, err := NewPrehash(h)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return optionsError("nil reader")
+	}
+	if _, err := io.Copy(p, r); err != nil {
+		return err
+	}
+	return pk.VerifyPrehash(sig, p)
+}
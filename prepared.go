@@ -0,0 +1,121 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+/*
+PreparedPublicKey is a Publickey prepared for verifying many signatures.
+The public key is validated only once, and t is expanded into a rotation table
+so that t*c is computed without modular reductions per coefficient.
+*/
+type PreparedPublicKey struct {
+	pk Publickey
+	/*rot[k] = -t[k] for k<n, and t[k-n] for k>=n, so that coefficients of x^pos*t are rot[n-pos:2n-pos]*/
+	rot    []ringelt
+	rotNeg []ringelt
+}
+
+//Prepare validates pk and returns its prepared form.
+func (pk *Publickey) Prepare() (*PreparedPublicKey, error) {
+	if err := pk.check(); err != nil {
+		return nil, err
+	}
+	params := pk.Params()
+	p := &PreparedPublicKey{
+		pk: Publickey{
+			params: params,
+			t:      append([]ringelt(nil), pk.t...),
+		},
+		rot:    make([]ringelt, 2*params.n),
+		rotNeg: make([]ringelt, 2*params.n),
+	}
+	for i, t := range pk.t {
+		mt := params.subMOD(0, t)
+		p.rot[i] = mt
+		p.rot[i+params.n] = t
+		p.rotNeg[i] = t
+		p.rotNeg[i+params.n] = mt
+	}
+	return p, nil
+}
+
+//Publickey returns the public key of p.
+func (p *PreparedPublicKey) Publickey() *Publickey {
+	return &Publickey{
+		params: p.pk.params,
+		t:      append([]ringelt(nil), p.pk.t...),
+	}
+}
+
+//Verify is same as Publickey.Verify.
+func (p *PreparedPublicKey) Verify(sig *Signature, message []byte) error {
+	return p.verify(sig, nil, message)
+}
+
+//VerifyWithOptions is same as Publickey.VerifyWithOptions.
+func (p *PreparedPublicKey) VerifyWithOptions(sig *Signature, message []byte, opts *SignOptions) error {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	dom, err := opts.domain(message)
+	if err != nil {
+		return err
+	}
+	return p.verify(sig, dom, message)
+}
+
+func (p *PreparedPublicKey) verify(sig *Signature, dom, message []byte) error {
+	if err := sig.checkCoefficients(); err != nil {
+		return err
+	}
+	if err := sig.check(); err != nil {
+		return err
+	}
+	if err := paramsError(p.pk.params, sig.Params()); err != nil {
+		return err
+	}
+	return p.verifyChecked(sig, dom, message)
+}
+
+func (p *PreparedPublicKey) verifyChecked(sig *Signature, dom, message []byte) error {
+	return verifyTC(p.mulC(sig.c), sig, dom, message)
+}
+
+/*mulC computes t*c by summing rotated t. Sums are at most omega*Q, which fits in uint32.*/
+func (p *PreparedPublicKey) mulC(c sparsePolyST) []ringelt {
+	params := p.pk.params
+	n := params.n
+	acc := make([]uint32, n)
+	for _, vc := range c {
+		pos := int(vc.pos)
+		rot := p.rotNeg[n-pos : 2*n-pos]
+		if vc.sign {
+			rot = p.rot[n-pos : 2*n-pos]
+		}
+		for j, r := range rot {
+			acc[j] += uint32(r)
+		}
+	}
+	v := params.newPoly()
+	for j, a := range acc {
+		v[j] = ringelt(a % uint32(params.q))
+	}
+	return v
+}
@@ -24,6 +24,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
 	"io"
 )
@@ -44,15 +45,26 @@ func newRandom(key, iv []byte) (*random, error) {
 	}, nil
 }
 
-func newRandom2() (*random, error) {
+func newRandom2(rnd io.Reader) (*random, error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
 	key := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+	if _, err := io.ReadFull(rnd, key); err != nil {
 		return nil, err
 	}
 	iv := make([]byte, 16)
 	return newRandom(key, iv)
 }
 
+func (r *random) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	r.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
+
 func (r *random) please(in []byte) uint64 {
 	out := make([]byte, len(in))
 	r.stream.XORKeyStream(out, in)
@@ -61,28 +73,52 @@ func (r *random) please(in []byte) uint64 {
 func (r *random) please2() uint64 {
 	return r.please(zero8)
 }
-func sampleGLPSecrets(seed []byte) ([constN]ringelt, [constN]ringelt, error) {
-	var s1, s2 [constN]ringelt
+func read64(rnd io.Reader) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(rnd, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func (p *Params) sampleGLPSecrets(seed []byte) ([]ringelt, []ringelt, error) {
 	rnd, err := newRandom(seed, make([]byte, aes.BlockSize))
 	if err != nil {
-		return s1, s2, err
+		return nil, nil, err
 	}
-	s1, err = sampleGLPSecret(rnd)
+	return p.sampleGLPSecretsFrom(rnd)
+}
+
+/*sampleGLPSecretsFrom samples s1,s2 from a random stream rnd.*/
+func (p *Params) sampleGLPSecretsFrom(rnd io.Reader) ([]ringelt, []ringelt, error) {
+	s1, err := p.sampleGLPSecret(rnd)
 	if err != nil {
-		return s1, s2, err
+		return nil, nil, err
 	}
-	s2, err = sampleGLPSecret(rnd)
+	s2, err := p.sampleGLPSecret(rnd)
 	return s1, s2, err
 }
 
-func sampleGLPSecret(rnd *random) ([constN]ringelt, error) {
-	var s [constN]ringelt
+/*
+sampleGLPSecret samples a polynomial with coefficients in {0, 1, Q-1} uniformly from rnd.
+Random 2-bit values of 3 are rejected by a branch, so it doesn't run in constant time.
+It leaks only the number of rejected values, which are discarded and independent of the output,
+while accepted values are mapped without branches.
+*/
+func (p *Params) sampleGLPSecret(rnd io.Reader) ([]ringelt, error) {
+	s := p.newPoly()
 	randBitsUsed := 0
 
-	rand64 := rnd.please2()
+	rand64, err := read64(rnd)
+	if err != nil {
+		return s, err
+	}
 	for i := range s {
 		if randBitsUsed >= 63 {
-			rand64 = rnd.please2()
+			rand64, err = read64(rnd)
+			if err != nil {
+				return s, err
+			}
 			randBitsUsed = 0
 		}
 		var rand2 uint16
@@ -94,43 +130,115 @@ func sampleGLPSecret(rnd *random) ([constN]ringelt, error) {
 				break
 			}
 		}
-		switch rand2 {
-		case 0:
-			s[i] = 0
-		case 1:
-			s[i] = 1
-		case 2:
-			s[i] = constQ - 1
-		case 3:
-			panic("invalid s")
-		}
+		/*map 0,1,2 to 0,1,Q-1 without branches*/
+		s[i] = ctSelect(ctEQ(uint32(rand2), 2), p.q-1, ringelt(rand2))
 	}
 	return s, nil
 }
 
+/*
+crand is a buffered reader of random numbers.
+Once reading from r fails, get16 returns 0 and the error is kept in err.
+*/
 type crand struct {
+	r   io.Reader
 	buf []byte
 	loc int
+	err error
 }
 
 func newCrand() *crand {
-	c := &crand{
-		buf: make([]byte, constN*8),
+	return newCrandFrom(rand.Reader)
+}
+
+func newCrandFrom(r io.Reader) *crand {
+	buf := make([]byte, constN*8)
+	return &crand{
+		r:   r,
+		buf: buf,
+		loc: len(buf),
+	}
+}
+
+/*
+deriveYSeed derives a key of AES for generating ephemeral y1,y2 from sk, message with its domain,
+and optional extra randomness (for hedged signing).
+*/
+func deriveYSeed(sk *SigningKey, dom, message, extra []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("GLYPH deterministic y"))
+	b := sk.Bytes()
+	h.Write(b)
+	wipe(b)
+	var l [8]byte
+	for _, b := range [][]byte{extra, dom} {
+		binary.LittleEndian.PutUint64(l[:], uint64(len(b)))
+		h.Write(l[:])
+		h.Write(b)
 	}
-	if _, err := io.ReadFull(rand.Reader, c.buf); err != nil {
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+/*newDetCrand returns crand for the n-th trial of signing, which is derived from seed. */
+func newDetCrand(seed []byte, n uint64) *crand {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv, n)
+	r, err := newRandom(seed, iv)
+	if err != nil {
 		panic(err)
 	}
-	return c
+	return newCrandFrom(r)
 }
 
 func (c *crand) get16() uint16 {
+	if c.err != nil {
+		return 0
+	}
 	if c.loc+2 >= len(c.buf) {
-		if _, err := io.ReadFull(rand.Reader, c.buf); err != nil {
-			panic(err)
+		if _, err := io.ReadFull(c.r, c.buf); err != nil {
+			c.err = err
+			return 0
 		}
 		c.loc = 0
 	}
 	r := binary.LittleEndian.Uint16(c.buf[c.loc:])
+	/*consumed random numbers may be parts of y*/
+	c.buf[c.loc], c.buf[c.loc+1] = 0, 0
 	c.loc += 2
 	return r
 }
+
+/*wipe overwrites the buffer with zeros. Next get16 reads new random numbers.*/
+func (c *crand) wipe() {
+	wipe(c.buf)
+	c.loc = len(c.buf)
+}
+
+/*sample y1,y2 uniformly from [-B,B]*/
+func (c *crand) sampleY(p *Params) (y1, y2 []ringelt, err error) {
+	y1 = p.newPoly()
+	y2 = p.newPoly()
+	mask := ringelt(1)<<(p.bBits+1) - 1
+	for i := 0; i < p.n; i++ {
+		for {
+			y1[i] = ringelt(c.get16()) /*get 16 bits of random */
+			y1[i] &= mask              /*take bottom (B_BITS + 1) bits */
+			if uint32(y1[i]) <= 2*uint32(p.b)+1 {
+				break
+			}
+		}
+		for {
+			y2[i] = ringelt(c.get16()) /*get 16 bits of random */
+			y2[i] &= mask              /*take bottom (B_BITS + 1) bits */
+			if uint32(y2[i]) <= 2*uint32(p.b)+1 {
+				break
+			}
+		}
+		/*map (B, 2B+1] to [-B,0) without branches*/
+		y1[i] = ctSelect(ctLT(uint32(p.b), uint32(y1[i])), p.q+p.b-y1[i], y1[i])
+		y2[i] = ctSelect(ctLT(uint32(p.b), uint32(y2[i])), p.q+p.b-y2[i], y2[i])
+	}
+	err = c.err
+	return
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import "unsafe"
+
+//MemoryProtection is a level of protection of memory storing secrets of a SigningKey.
+type MemoryProtection int
+
+//Levels of memory protection.
+const (
+	//MemoryHeap means that secrets are stored in the Go heap, which may be swapped out or dumped.
+	MemoryHeap MemoryProtection = iota
+	//MemoryUnlocked means that secrets are stored in mmap'd pages between guard pages,
+	//which are excluded from core dumps, but could not be locked (e.g. RLIMIT_MEMLOCK is too low).
+	MemoryUnlocked
+	//MemoryLocked is same as MemoryUnlocked, but the pages are locked and never swapped out.
+	MemoryLocked
+)
+
+func (m MemoryProtection) String() string {
+	switch m {
+	case MemoryHeap:
+		return "heap"
+	case MemoryUnlocked:
+		return "unlocked"
+	case MemoryLocked:
+		return "locked"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+secureMem is memory outside of the Go heap for secrets.
+region is the whole mapping including guard pages, and data is the accessible part of it.
+*/
+type secureMem struct {
+	region []byte
+	data   []byte
+	locked bool
+}
+
+func (m *secureMem) protection() MemoryProtection {
+	if m.locked {
+		return MemoryLocked
+	}
+	return MemoryUnlocked
+}
+
+/*poly returns n coefficients at off bytes in m.*/
+func (m *secureMem) poly(off, n int) []ringelt {
+	var x ringelt
+	_ = m.data[off+n*int(unsafe.Sizeof(x))-1]
+	return unsafe.Slice((*ringelt)(unsafe.Pointer(&m.data[off])), n)
+}
+
+/*
+UseSecureMemory moves the secrets of sk (s1, s2 and the seed) into memory outside of the Go heap,
+i.e. mmap'd pages between inaccessible guard pages, which are excluded from core dumps by MADV_DONTDUMP
+and locked by mlock so that they are never swapped out. Copies in the Go heap are wiped.
+If the pages cannot be locked, e.g. because RLIMIT_MEMLOCK is too low, they are used without locking
+and MemoryUnlocked is returned. It is supported only on Linux and returns ErrSecureMemoryUnsupported otherwise.
+
+The memory is released only by Destroy, so sk should be destroyed after use.
+Copies of sk share the memory and must not be used after that.
+sk must not be used concurrently.
+*/
+func (sk *SigningKey) UseSecureMemory() (MemoryProtection, error) {
+	if err := sk.check(); err != nil {
+		return MemoryHeap, err
+	}
+	if sk.mem != nil {
+		return sk.mem.protection(), nil
+	}
+	var x ringelt
+	polySize := len(sk.s1) * int(unsafe.Sizeof(x))
+	mem, err := allocSecure(2*polySize + len(sk.seed))
+	if err != nil {
+		return MemoryHeap, err
+	}
+	s1 := mem.poly(0, len(sk.s1))
+	s2 := mem.poly(polySize, len(sk.s2))
+	copy(s1, sk.s1)
+	copy(s2, sk.s2)
+	wipePoly(sk.s1, sk.s2)
+	sk.s1, sk.s2 = s1, s2
+	if sk.seed != nil {
+		seed := mem.data[2*polySize : 2*polySize+len(sk.seed)]
+		copy(seed, sk.seed)
+		wipe(sk.seed)
+		sk.seed = seed
+	}
+	sk.mem = mem
+	return mem.protection(), nil
+}
+
+/*
+replace sets sk to k after destroying the secrets of sk, e.g. when unmarshaling into sk.
+If sk is in secure memory, k is moved into secure memory first.
+If it fails, k is destroyed and sk is not changed.
+*/
+func (sk *SigningKey) replace(k *SigningKey) error {
+	if sk.mem != nil {
+		if _, err := k.UseSecureMemory(); err != nil {
+			k.Destroy()
+			return err
+		}
+	}
+	sk.Destroy()
+	*sk = *k
+	return nil
+}
+
+//MemoryProtection returns the level of protection of memory storing the secrets of sk.
+func (sk *SigningKey) MemoryProtection() MemoryProtection {
+	if sk == nil || sk.mem == nil {
+		return MemoryHeap
+	}
+	return sk.mem.protection()
+}
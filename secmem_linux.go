@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"os"
+	"syscall"
+)
+
+/*madvDontDump is MADV_DONTDUMP, which is not defined in syscall.*/
+const madvDontDump = 0x10
+
+/*mlock is a variable for testing the fallback.*/
+var mlock = syscall.Mlock
+
+/*
+allocSecure maps size bytes (rounded up to pages) between guard pages with PROT_NONE.
+The accessible pages are excluded from core dumps, and locked if possible.
+*/
+func allocSecure(size int) (*secureMem, error) {
+	page := os.Getpagesize()
+	n := (size + page - 1) / page * page
+	region, err := syscall.Mmap(-1, 0, n+2*page, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, err
+	}
+	m := &secureMem{
+		region: region,
+		data:   region[page : page+n : page+n],
+	}
+	if err := syscall.Mprotect(m.data, syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+		syscall.Munmap(region)
+		return nil, err
+	}
+	if err := syscall.Madvise(m.data, madvDontDump); err != nil {
+		syscall.Munmap(region)
+		return nil, err
+	}
+	/*fall back to unlocked pages if RLIMIT_MEMLOCK is too low (ENOMEM) or locking is not permitted*/
+	m.locked = mlock(m.data) == nil
+	return m, nil
+}
+
+/*free wipes, unlocks and unmaps m.*/
+func (m *secureMem) free() error {
+	if m.region == nil {
+		return nil
+	}
+	wipe(m.data)
+	if m.locked {
+		syscall.Munlock(m.data)
+	}
+	err := syscall.Munmap(m.region)
+	m.region, m.data = nil, nil
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+/*rlimitMemlock is RLIMIT_MEMLOCK, which is not defined in syscall (except mips).*/
+const rlimitMemlock = 8
+
+/*vmFlags returns VmFlags of the mapping containing addr in /proc/self/smaps.*/
+func vmFlags(t *testing.T, addr uintptr) []string {
+	f, err := os.Open("/proc/self/smaps")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	found := false
+	for s.Scan() {
+		line := s.Text()
+		var start, end uintptr
+		if n, _ := fmt.Sscanf(line, "%x-%x ", &start, &end); n == 2 && strings.Contains(line, " ") {
+			found = start <= addr && addr < end
+			continue
+		}
+		if found && strings.HasPrefix(line, "VmFlags:") {
+			return strings.Fields(line)[1:]
+		}
+	}
+	t.Fatal("mapping is not found")
+	return nil
+}
+
+func hasFlag(flags []string, f string) bool {
+	for _, v := range flags {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+var faultSink byte
+
+/*fault returns true if reading b[i] causes a fault.*/
+func fault(b []byte, i int) (faulted bool) {
+	old := debug.SetPanicOnFault(true)
+	defer debug.SetPanicOnFault(old)
+	defer func() {
+		faulted = recover() != nil
+	}()
+	faultSink = b[i]
+	return false
+}
+
+func TestSecureMemoryLinux(t *testing.T) {
+	sk, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk.Destroy()
+	if _, err := sk.UseSecureMemory(); err != nil {
+		t.Fatal(err)
+	}
+	m := sk.mem
+	page := os.Getpagesize()
+	if fault(m.data, 0) || fault(m.data, len(m.data)-1) {
+		t.Error("data should be accessible")
+	}
+	if !fault(m.region, page-1) || !fault(m.region, len(m.region)-page) {
+		t.Error("guard pages should not be accessible")
+	}
+	flags := vmFlags(t, uintptr(unsafe.Pointer(&m.data[0])))
+	if !hasFlag(flags, "dd") {
+		t.Error("data should not be dumped", flags)
+	}
+	if m.locked != hasFlag(flags, "lo") {
+		t.Error("invalid lock", m.locked, flags)
+	}
+	if hasFlag(vmFlags(t, uintptr(unsafe.Pointer(&m.region[0]))), "rd") {
+		t.Error("guard page should not be readable")
+	}
+}
+
+func TestSecureMemoryFallback(t *testing.T) {
+	mlock = func([]byte) error {
+		return syscall.ENOMEM
+	}
+	defer func() {
+		mlock = syscall.Mlock
+	}()
+	sk, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk.Destroy()
+	prot, err := sk.UseSecureMemory()
+	if err != nil || prot != MemoryUnlocked {
+		t.Error("should fall back to unlocked memory", prot, err)
+	}
+	if _, err := sk.SignMessage([]byte("message")); err != nil {
+		t.Error(err)
+	}
+
+	/*with RLIMIT_MEMLOCK = 0, which is ignored by privileged processes*/
+	mlock = syscall.Mlock
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		t.Skip("RLIMIT_MEMLOCK is different on mips")
+	}
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(rlimitMemlock, &rlim); err != nil {
+		t.Skip(err)
+	}
+	low := rlim
+	low.Cur = 0
+	if err := syscall.Setrlimit(rlimitMemlock, &low); err != nil {
+		t.Skip(err)
+	}
+	defer func() {
+		if err := syscall.Setrlimit(rlimitMemlock, &rlim); err != nil {
+			t.Error(err)
+		}
+	}()
+	sk2, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sk2.Destroy()
+	prot, err = sk2.UseSecureMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("protection with RLIMIT_MEMLOCK=0:", prot)
+	if os.Geteuid() != 0 && prot != MemoryUnlocked {
+		t.Error("should fall back to unlocked memory", prot)
+	}
+}
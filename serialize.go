@@ -21,291 +21,483 @@
 package glyph
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
-	"math/big"
 
 	"github.com/vmihailenco/msgpack"
 )
 
 //Bytes serialize Publickey.
 func (p *Publickey) Bytes() []byte {
-	var r big.Int
-	for i := range p.t {
-		r.Lsh(&r, qBits)
-		t := p.t[constN-1-i]
-		tt := big.NewInt(int64(t))
-		r.Or(&r, tt)
+	params := p.Params()
+	b := make([]byte, params.PKSize())
+	w := bitWriter{b: b}
+	for _, t := range p.t {
+		w.write(uint32(t), params.qBits)
 	}
-	b := r.Bytes()
-	bb := make([]byte, PKSize)
-	copy(bb[PKSize-len(b):], b)
-	return bb
+	w.flush()
+	return b
 }
 
-//NewPublickey creates an Publickey from serialized bytes.
+/*
+NewPublickey creates an Publickey from serialized bytes, which are either framed by Encode
+or the legacy raw form of ParamsCompact by Bytes.
+*/
 func NewPublickey(b []byte) (*Publickey, error) {
-	if len(b) != PKSize {
-		return nil, errors.New("invalid length of bytes for PK")
-	}
-	var r big.Int
-	r.SetBytes(b)
-	p := &Publickey{}
-	mask := ^(^0 << qBits)
-	maskQ := big.NewInt(int64(mask))
-	for i := range p.t {
-		var v big.Int
-		v.And(&r, maskQ)
-		p.t[i] = ringelt(v.Uint64())
-		r.Rsh(&r, qBits)
+	return decodePublickey(nil, b)
+}
+
+//NewPublickey is same as the function NewPublickey, but accepts only public keys of the parameter set params.
+func (params *Params) NewPublickey(b []byte) (*Publickey, error) {
+	return decodePublickey(params, b)
+}
+
+func decodePublickey(params *Params, b []byte) (*Publickey, error) {
+	params, b, err := unframe(params, b, kindPublickey, "PK", (*Params).PKSize)
+	if err != nil {
+		return nil, err
 	}
+	return params.newPublickey(b)
+}
+
+/*newPublickey decodes the raw form of a public key.*/
+func (params *Params) newPublickey(b []byte) (*Publickey, error) {
+	if len(b) != params.PKSize() {
+		return nil, lengthError("PK", len(b))
+	}
+	p := params.unpackPublickey(b)
 	return p, p.check()
 }
 
+/*unpackPublickey unpacks the raw form of a public key with the correct length without checking it.*/
+func (params *Params) unpackPublickey(b []byte) *Publickey {
+	p := &Publickey{
+		params: params,
+		t:      params.newPoly(),
+	}
+	r := bitReader{b: b}
+	for i := range p.t {
+		p.t[i] = ringelt(r.read(params.qBits))
+	}
+	return p
+}
+
 //Bytes serialize SigningKey.
 func (s *SigningKey) Bytes() []byte {
-	var r big.Int
-	for i := range s.s2 {
-		r.Lsh(&r, 2)
-		t := s.s2[constN-1-i]
-		if t == constQ-1 {
-			t = 2
-		}
-		tt := big.NewInt(int64(t))
-		r.Or(&r, tt)
-	}
-	for i := range s.s1 {
-		r.Lsh(&r, 2)
-		t := s.s1[constN-1-i]
-		if t == constQ-1 {
-			t = 2
+	params := s.Params()
+	b := make([]byte, params.SKSize())
+	w := bitWriter{b: b}
+	for _, poly := range [][]ringelt{s.s1, s.s2} {
+		for _, t := range poly {
+			w.write(uint32(ctSelect(ctEQ(uint32(t), uint32(params.q-1)), 2, t)), 2)
 		}
-		tt := big.NewInt(int64(t))
-		r.Or(&r, tt)
 	}
-	b := r.Bytes()
-	bb := make([]byte, SKSize)
-	copy(bb[SKSize-len(b):], b)
-	return bb
+	w.flush()
+	return b
 }
 
-//NewSigningKey creates an SiningKey from serialized bytes.
+/*
+NewSigningKey creates an SiningKey from serialized bytes, which are either framed by Encode,
+or the legacy raw form of ParamsCompact, i.e. the expanded form (SKSize bytes, by Bytes) or the seed (SeedSize bytes, by Seed).
+*/
 func NewSigningKey(b []byte) (*SigningKey, error) {
-	if len(b) != SKSize {
-		return nil, errors.New("invalid length of bytes for SK")
-	}
-	var r big.Int
-	r.SetBytes(b)
-	s := &SigningKey{}
-	mask2 := big.NewInt(int64(3))
-	for i := range s.s1 {
-		var v big.Int
-		v.And(&r, mask2)
-		s.s1[i] = ringelt(v.Uint64())
-		if s.s1[i] == 2 {
-			s.s1[i] = constQ - 1
-		}
-		r.Rsh(&r, 2)
-	}
-	for i := range s.s2 {
-		var v big.Int
-		v.And(&r, mask2)
-		s.s2[i] = ringelt(v.Uint64())
-		if s.s2[i] == 2 {
-			s.s2[i] = constQ - 1
-		}
-		r.Rsh(&r, 2)
+	return decodeSigningKey(nil, b)
+}
+
+//NewSigningKey is same as the function NewSigningKey, but accepts only signing keys of the parameter set params.
+func (params *Params) NewSigningKey(b []byte) (*SigningKey, error) {
+	return decodeSigningKey(params, b)
+}
+
+func decodeSigningKey(params *Params, b []byte) (*SigningKey, error) {
+	if len(b) == SeedSize {
+		return paramsOrDefault(params).NewKeyFromSeed(b)
+	}
+	params, b, err := unframe(params, b, kindSigningKey, "SK", (*Params).SKSize)
+	if err != nil {
+		return nil, err
+	}
+	return params.newSigningKey(b)
+}
+
+/*newSigningKey decodes the raw form of a signing key, i.e. the expanded form or the seed.*/
+func (params *Params) newSigningKey(b []byte) (*SigningKey, error) {
+	if len(b) == SeedSize {
+		return params.NewKeyFromSeed(b)
+	}
+	if len(b) != params.SKSize() {
+		return nil, lengthError("SK", len(b))
 	}
+	s := params.unpackSigningKey(b)
 	return s, s.check()
 }
 
-//Bytes serialize sparsePolyST.
-func (s *sparsePolyST) bytes() *big.Int {
-	var r big.Int
-	for i := 0; i < omega; i++ {
-		r.Lsh(&r, 1)
-		d := 0
-		if s[omega-i-1].sign {
-			d = 1
-		}
-		tt := big.NewInt(int64(d))
-		r.Or(&r, tt)
-		r.Lsh(&r, nBits)
-		dd := s[omega-i-1].pos
-		tt = big.NewInt(int64(dd))
-		r.Or(&r, tt)
-	}
-	return &r
-}
-
-//newSparsePoly creates an sparsePolyST from serialized bytes.
-func newSparsePoly(r *big.Int) (*sparsePolyST, error) {
-	var s sparsePolyST
-	mask := ^(^0 << nBits)
-	maskN := big.NewInt(int64(mask))
-	for i := 0; i < omega; i++ {
-		var v big.Int
-		v.And(r, maskN)
-		s[i].pos = uint16(v.Uint64())
-		r.Rsh(r, nBits)
-		if r.Bit(0) == 1 {
-			s[i].sign = true
+/*unpackSigningKey unpacks the expanded form of a signing key with the correct length without checking it.*/
+func (params *Params) unpackSigningKey(b []byte) *SigningKey {
+	s := &SigningKey{
+		params: params,
+		s1:     params.newPoly(),
+		s2:     params.newPoly(),
+	}
+	r := bitReader{b: b}
+	for _, poly := range [][]ringelt{s.s1, s.s2} {
+		for i := range poly {
+			d := r.read(2)
+			poly[i] = ctSelect(ctEQ(d, 2), params.q-1, ringelt(d))
 		}
-		r.Rsh(r, 1)
 	}
-	return &s, nil
+	return s
 }
 
 //Bytes serialize Signature.
 func (s *Signature) Bytes() []byte {
-	r := s.c.bytes()
-	for i := 0; i < constN; i++ {
-		r.Lsh(r, 2)
-		d := s.z2[constN-i-1]
+	params := s.Params()
+	k := params.k()
+	b := make([]byte, params.SigSize())
+	w := bitWriter{b: b}
+	for _, z1 := range s.z1 {
+		d := uint32(z1)
+		if d*2 > uint32(params.q) {
+			d = (1 << (params.bBits + 1)) - (uint32(params.q) - d)
+		}
+		w.write(d, params.bBits+1)
+	}
+	for _, d := range s.z2 {
 		switch d {
 		case 0:
-		case constB - omega:
+		case k:
 			d = 1
-		case constQ - (constB - omega):
+		case params.q - k:
 			d = 2
 		}
-		tt := big.NewInt(int64(d))
-		r.Or(r, tt)
-	}
-	for i := 0; i < constN; i++ {
-		r.Lsh(r, bBits+1)
-		d := s.z1[constN-i-1]
-		if d*2 > constQ {
-			d = (1 << (bBits + 1)) - (constQ - d)
+		w.write(uint32(d), 2)
+	}
+	for _, c := range s.c {
+		w.write(uint32(c.pos), params.nBits)
+		var sign uint32
+		if c.sign {
+			sign = 1
 		}
-		tt := big.NewInt(int64(d))
-		r.Or(r, tt)
+		w.write(sign, 1)
 	}
-	b := r.Bytes()
-	bb := make([]byte, SigSize)
-	copy(bb[SigSize-len(b):], b)
-	return bb
+	w.flush()
+	return b
 }
 
-//NewSignature creates an sparsePolyST from serialized bytes.
+/*
+NewSignature creates a Signature from serialized bytes, which are either framed by Encode
+or the legacy raw form of ParamsCompact by Bytes.
+*/
 func NewSignature(b []byte) (*Signature, error) {
-	if len(b) != SigSize {
-		return nil, errors.New("invalid length of bytes for Sig")
-	}
-	var s Signature
-	var r big.Int
-	r.SetBytes(b)
-	mask := ^(^0 << (bBits + 1))
-	maskB := big.NewInt(int64(mask))
-	for i := 0; i < constN; i++ {
-		var v big.Int
-		s.z1[i] = ringelt(v.And(&r, maskB).Uint64())
-		if s.z1[i]*2 > 1<<(bBits+1) {
-			s.z1[i] = constQ - ((1 << (bBits + 1)) - s.z1[i])
-		}
-		r.Rsh(&r, bBits+1)
+	return decodeSignature(nil, b)
+}
+
+//NewSignature is same as the function NewSignature, but accepts only signatures of the parameter set params.
+func (params *Params) NewSignature(b []byte) (*Signature, error) {
+	return decodeSignature(params, b)
+}
+
+func decodeSignature(params *Params, b []byte) (*Signature, error) {
+	params, b, err := unframe(params, b, kindSignature, "Sig", (*Params).SigSize)
+	if err != nil {
+		return nil, err
 	}
+	return params.newSignature(b)
+}
 
-	mask2 := big.NewInt(0x3)
-	for i := 0; i < constN; i++ {
-		var v big.Int
-		d := v.And(&r, mask2).Uint64()
+/*newSignature decodes the raw form of a signature.*/
+func (params *Params) newSignature(b []byte) (*Signature, error) {
+	if len(b) != params.SigSize() {
+		return nil, lengthError("Sig", len(b))
+	}
+	s := params.unpackSignature(b)
+	return s, s.check()
+}
+
+/*unpackSignature unpacks the raw form of a signature with the correct length without checking it.*/
+func (params *Params) unpackSignature(b []byte) *Signature {
+	k := params.k()
+	s := &Signature{
+		params: params,
+		z1:     params.newPoly(),
+		z2:     params.newPoly(),
+		c:      make(sparsePolyST, params.omega),
+	}
+	r := bitReader{b: b}
+	for i := range s.z1 {
+		z1 := r.read(params.bBits + 1)
+		if z1*2 > 1<<(params.bBits+1) {
+			z1 = uint32(params.q) - ((1 << (params.bBits + 1)) - z1)
+		}
+		s.z1[i] = ringelt(z1)
+	}
+	for i := range s.z2 {
+		d := ringelt(r.read(2))
 		switch d {
 		case 0:
 		case 1:
-			d = constB - omega
+			d = k
 		case 2:
-			d = constQ - (constB - omega)
+			d = params.q - k
 		}
-		s.z2[i] = ringelt(d)
-		r.Rsh(&r, 2)
+		s.z2[i] = d
 	}
-	var err error
-	s.c, err = newSparsePoly(&r)
-	if err != nil {
-		return nil, err
+	for i := range s.c {
+		s.c[i].pos = uint16(r.read(params.nBits))
+		s.c[i].sign = r.read(1) == 1
+	}
+	return s
+}
+
+/*paramsName returns the name of params for encoding, which is empty for ParamsCompact for compatibility.*/
+func paramsName(params *Params) string {
+	if params == ParamsCompact {
+		return ""
+	}
+	return params.name
+}
+
+func paramsFromName(name string) (*Params, error) {
+	if name == "" {
+		return ParamsCompact, nil
 	}
-	return &s, s.check()
+	return ParamsByName(name)
 }
 
+/*isJSONString returns true if JSON b is a string, i.e. the base64 form by MarshalJSON.*/
+func isJSONString(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '"'
+}
+
+/*isJSONNull returns true if JSON b is null, which leaves the value unchanged by convention.*/
+func isJSONNull(b []byte) bool {
+	return string(bytes.TrimSpace(b)) == "null"
+}
+
+/*publickey is the legacy form of Publickey in JSON and the form in msgpack.*/
 type publickey struct {
-	T [constN]ringelt `json:"t"`
+	Params string    `json:"params,omitempty" msgpack:"params,omitempty"`
+	T      []ringelt `json:"t"`
 }
 
-//MarshalJSON  marshals Publickey into valid JSON.
+func (p *Publickey) encodable() *publickey {
+	return &publickey{
+		Params: paramsName(p.Params()),
+		T:      p.t,
+	}
+}
+
+func (p *Publickey) decoded(s *publickey) error {
+	params, err := paramsFromName(s.Params)
+	if err != nil {
+		return err
+	}
+	pk := Publickey{
+		params: params,
+		t:      s.T,
+	}
+	if err := pk.check(); err != nil {
+		return err
+	}
+	*p = pk
+	return nil
+}
+
+//MarshalJSON  marshals Publickey into valid JSON, i.e. the base64 string of Encode.
 func (p *Publickey) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&publickey{
-		T: p.t,
-	})
+	return json.Marshal(p.Encode())
 }
 
-//UnmarshalJSON  unmarshals JSON to Publickey.
+//UnmarshalJSON  unmarshals JSON to Publickey, which is either the base64 form or the legacy form.
 func (p *Publickey) UnmarshalJSON(b []byte) error {
+	if isJSONNull(b) {
+		return nil
+	}
+	if isJSONString(b) {
+		var raw []byte
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return err
+		}
+		pk, err := NewPublickey(raw)
+		if err != nil {
+			return err
+		}
+		*p = *pk
+		return nil
+	}
 	var s publickey
-	err := json.Unmarshal(b, &s)
-	if err == nil {
-		p.t = s.T
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
 	}
-	return err
+	return p.decoded(&s)
 }
 
 //EncodeMsgpack  marshals Publickey into valid JSON.
 func (p *Publickey) EncodeMsgpack(enc *msgpack.Encoder) error {
-	return enc.Encode(&publickey{
-		T: p.t,
-	})
+	return enc.Encode(p.encodable())
 }
 
 //DecodeMsgpack  unmarshals JSON to Publickey.
 func (p *Publickey) DecodeMsgpack(dec *msgpack.Decoder) error {
 	var s publickey
-	err := dec.Decode(&s)
-	if err == nil {
-		p.t = s.T
+	if err := dec.Decode(&s); err != nil {
+		return err
 	}
-	return err
+	return p.decoded(&s)
 }
 
-//SigningKey of glyph signature.
+/*signingKey is the legacy form of SigningKey in JSON and the form in msgpack.*/
 type signingKey struct {
-	S1 [constN]ringelt `json:"s1"`
-	S2 [constN]ringelt `json:"s2"`
+	Params string    `json:"params,omitempty" msgpack:"params,omitempty"`
+	S1     []ringelt `json:"s1"`
+	S2     []ringelt `json:"s2"`
+}
+
+func (s *SigningKey) encodable() *signingKey {
+	return &signingKey{
+		Params: paramsName(s.Params()),
+		S1:     s.s1,
+		S2:     s.s2,
+	}
 }
 
-//MarshalJSON  marshals SiningKey into valid JSON.
+func (s *SigningKey) decoded(ss *signingKey) error {
+	params, err := paramsFromName(ss.Params)
+	if err != nil {
+		return err
+	}
+	sk := SigningKey{
+		params: params,
+		s1:     ss.S1,
+		s2:     ss.S2,
+	}
+	if err := sk.check(); err != nil {
+		sk.Destroy()
+		return err
+	}
+	return s.replace(&sk)
+}
+
+/*
+ExportableSigningKey is a SigningKey which can be marshaled into JSON, msgpack, text and binary.
+SigningKey itself refuses to be marshaled with ErrSecretExport so that
+it never leaks into logs or structured data by accident.
+*/
+type ExportableSigningKey SigningKey
+
+//Exportable returns sk as ExportableSigningKey, which shares the secrets with sk.
+func (s *SigningKey) Exportable() *ExportableSigningKey {
+	return (*ExportableSigningKey)(s)
+}
+
+//SigningKey returns e as SigningKey, which shares the secrets with e.
+func (e *ExportableSigningKey) SigningKey() *SigningKey {
+	return (*SigningKey)(e)
+}
+
+//MarshalJSON returns ErrSecretExport. Use Exportable to marshal sk.
 func (s *SigningKey) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&signingKey{
-		S1: s.s1,
-		S2: s.s2,
-	})
+	return nil, ErrSecretExport
+}
+
+//MarshalJSON  marshals e into valid JSON, i.e. the base64 string of Encode.
+func (e *ExportableSigningKey) MarshalJSON() ([]byte, error) {
+	b := e.SigningKey().Encode()
+	defer wipe(b)
+	return json.Marshal(b)
+}
+
+//UnmarshalJSON  unmarshals JSON to e, which is either the base64 form or the legacy form.
+func (e *ExportableSigningKey) UnmarshalJSON(b []byte) error {
+	return e.SigningKey().UnmarshalJSON(b)
 }
 
-//UnmarshalJSON  unmarshals JSON to SiningKey.
+//UnmarshalJSON  unmarshals JSON to SiningKey, which is either the base64 form or the legacy form.
 func (s *SigningKey) UnmarshalJSON(b []byte) error {
+	if isJSONNull(b) {
+		return nil
+	}
+	if isJSONString(b) {
+		var raw []byte
+		defer func() { wipe(raw) }()
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return err
+		}
+		sk, err := NewSigningKey(raw)
+		if err != nil {
+			return err
+		}
+		return s.replace(sk)
+	}
 	var ss signingKey
-	err := json.Unmarshal(b, &ss)
-	if err == nil {
-		s.s1 = ss.S1
-		s.s2 = ss.S2
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
 	}
-	return err
+	return s.decoded(&ss)
 }
 
-//EncodeMsgpack  marshals SigningKey into valid JSON.
+//EncodeMsgpack returns ErrSecretExport. Use Exportable to marshal sk.
 func (s *SigningKey) EncodeMsgpack(enc *msgpack.Encoder) error {
-	return enc.Encode(&signingKey{
-		S1: s.s1,
-		S2: s.s2,
-	})
+	return ErrSecretExport
+}
+
+//EncodeMsgpack  marshals e into msgpack.
+func (e *ExportableSigningKey) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(e.SigningKey().encodable())
+}
+
+//DecodeMsgpack  unmarshals msgpack to e.
+func (e *ExportableSigningKey) DecodeMsgpack(dec *msgpack.Decoder) error {
+	return e.SigningKey().DecodeMsgpack(dec)
 }
 
 //DecodeMsgpack  unmarshals JSON to SigningKey.
 func (s *SigningKey) DecodeMsgpack(dec *msgpack.Decoder) error {
 	var ss signingKey
-	err := dec.Decode(&ss)
-	if err == nil {
-		s.s1 = ss.S1
-		s.s2 = ss.S2
+	if err := dec.Decode(&ss); err != nil {
+		return err
+	}
+	return s.decoded(&ss)
+}
+
+//MarshalJSON  marshals Signature into valid JSON, i.e. the base64 string of Encode.
+func (s *Signature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Encode())
+}
+
+//UnmarshalJSON  unmarshals JSON to Signature.
+func (s *Signature) UnmarshalJSON(b []byte) error {
+	if isJSONNull(b) {
+		return nil
+	}
+	var raw []byte
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	sig, err := NewSignature(raw)
+	if err != nil {
+		return err
+	}
+	*s = *sig
+	return nil
+}
+
+//EncodeMsgpack  marshals Signature into msgpack bytes of Encode.
+func (s *Signature) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeBytes(s.Encode())
+}
+
+//DecodeMsgpack  unmarshals msgpack to Signature.
+func (s *Signature) DecodeMsgpack(dec *msgpack.Decoder) error {
+	raw, err := dec.DecodeBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := NewSignature(raw)
+	if err != nil {
+		return err
 	}
-	return err
+	*s = *sig
+	return nil
 }
@@ -0,0 +1,443 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AidosKuneen/numcpu"
+)
+
+const maxContextLength = 255
+
+//SignMode is a way to choose ephemeral y1,y2 in signing.
+type SignMode int
+
+//Modes of signing.
+const (
+	//Randomized samples y1,y2 from crypto/rand.
+	Randomized SignMode = iota
+	//Deterministic derives y1,y2 (and ones for every retry after rejections)
+	//from the signing key and the message, so the signature is always same.
+	Deterministic
+	//Hedged is same as Deterministic, but mixes fresh randomness into the derivation.
+	Hedged
+)
+
+//SignOptions are options for signing. nil means default options.
+type SignOptions struct {
+	Mode SignMode
+	//Rand is a source of randomness for Randomized and Hedged modes.
+	//If nil, crypto/rand.Reader is used.
+	Rand io.Reader
+	//Hash is the hash function of the message in pre-hashed mode (HashGLYPH).
+	//crypto.Hash(0) means that the message is not hashed (pure mode).
+	Hash crypto.Hash
+	//Context is an application context string (at most 255 bytes) for domain separation.
+	//Signatures with different contexts are never valid for each other.
+	Context string
+}
+
+//HashFunc returns opts.Hash, which implements crypto.SignerOpts.
+func (opts *SignOptions) HashFunc() crypto.Hash {
+	return opts.Hash
+}
+
+/*domain checks message and returns the prefix for domain separation.*/
+func (opts *SignOptions) domain(message []byte) ([]byte, error) {
+	if opts.Hash != crypto.Hash(0) {
+		if !opts.Hash.Available() {
+			return nil, optionsError("unavailable hash function")
+		}
+		if len(message) != opts.Hash.Size() {
+			return nil, optionsError("invalid length of the digest")
+		}
+	}
+	if len(opts.Context) > maxContextLength {
+		return nil, optionsError("context string is too long")
+	}
+	return domain(opts.Hash, opts.Context), nil
+}
+
+/*
+Signer is a pool of workers which runs rejection sampling for signing.
+All Sign calls on a Signer share its workers. Every attempt of rejection sampling
+is scheduled in FIFO order, so that concurrent requests proceed in round-robin.
+*/
+type Signer struct {
+	workers int
+	slots   chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*signJob
+	closed bool
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type signResult struct {
+	sig *Signature
+	err error
+}
+
+type signJob struct {
+	ctx     context.Context
+	sk      *SigningKey
+	message []byte
+	dom     []byte
+	done    int32
+	result  chan *signResult
+
+	/*crand is non-nil only if a source of randomness is specified*/
+	crand  *crand
+	randMu sync.Mutex
+
+	/*seed is nil in randomized mode*/
+	seed     []byte
+	mu       sync.Mutex
+	next     uint64
+	inflight map[uint64]struct{}
+	best     *Signature
+	bestN    uint64
+	/*running counts claimed trials, which use sk and crand, until they are reported*/
+	running sync.WaitGroup
+}
+
+var (
+	defSigner     *Signer
+	defSignerOnce sync.Once
+)
+
+func defaultSigner() *Signer {
+	defSignerOnce.Do(func() {
+		defSigner = NewSigner(numcpu.NumCPU(), 0)
+	})
+	return defSigner
+}
+
+/*
+NewSigner starts a Signer with workers goroutines.
+queue is the max number of Sign requests being processed at once,
+further requests wait until one of them finishes.
+If workers<=0, the number of CPUs is used. If queue<=0, the number of requests is not limited.
+*/
+func NewSigner(workers, queue int) *Signer {
+	if workers <= 0 {
+		workers = numcpu.NumCPU()
+	}
+	s := &Signer{
+		workers: workers,
+		quit:    make(chan struct{}),
+	}
+	if queue > 0 {
+		s.slots = make(chan struct{}, queue)
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+/*
+Sign signs a message by sk using workers in the pool.
+It returns ctx.Err() if ctx is done before finishing, and ErrSignerClosed if the Signer is closed.
+*/
+func (s *Signer) Sign(ctx context.Context, sk *SigningKey, message []byte) (*Signature, error) {
+	return s.SignWithOptions(ctx, sk, message, nil)
+}
+
+//SignWithOptions is same as Sign, but signs with opts.
+func (s *Signer) SignWithOptions(ctx context.Context, sk *SigningKey, message []byte, opts *SignOptions) (*Signature, error) {
+	if opts == nil {
+		opts = &SignOptions{}
+	}
+	dom, err := opts.domain(message)
+	if err != nil {
+		return nil, err
+	}
+	if err := sk.check(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	job := &signJob{
+		ctx:      ctx,
+		sk:       sk,
+		message:  message,
+		dom:      dom,
+		result:   make(chan *signResult, 1),
+		inflight: make(map[uint64]struct{}),
+	}
+	/*runs last, after the job is marked as done*/
+	defer job.wipe()
+	rnd := opts.Rand
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	switch opts.Mode {
+	case Randomized:
+		if opts.Rand != nil {
+			job.crand = newCrandFrom(opts.Rand)
+		}
+	case Deterministic:
+		job.seed = deriveYSeed(sk, dom, message, nil)
+	case Hedged:
+		extra := make([]byte, 32)
+		if _, err := io.ReadFull(rnd, extra); err != nil {
+			return nil, err
+		}
+		job.seed = deriveYSeed(sk, dom, message, extra)
+		wipe(extra)
+	default:
+		return nil, optionsError("unknown sign mode")
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.quit:
+			return nil, ErrSignerClosed
+		}
+	}
+	/*trials must not use sk and opts.Rand after returning*/
+	defer job.drain()
+
+	/*put tokens for all workers so that a single request can use the whole pool*/
+	if !s.push(job, s.workers) {
+		return nil, ErrSignerClosed
+	}
+	select {
+	case r := <-job.result:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.sig, r.sig.check()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.quit:
+		return nil, ErrSignerClosed
+	}
+}
+
+//Close stops all workers and waits for them to exit. Pending Sign calls return ErrSignerClosed.
+func (s *Signer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.queue = nil
+	close(s.quit)
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Signer) push(job *signJob, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		s.queue = append(s.queue, job)
+	}
+	s.cond.Broadcast()
+	return true
+}
+
+func (s *Signer) pop() *signJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) == 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return nil
+	}
+	job := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return job
+}
+
+func (s *Signer) work() {
+	defer s.wg.Done()
+	crand := newCrand()
+	defer func() { crand.wipe() }()
+	for {
+		job := s.pop()
+		if job == nil {
+			return
+		}
+		n, ok := job.claim()
+		if !ok {
+			continue
+		}
+		if testHookClaimed != nil {
+			testHookClaimed()
+		}
+		y1, y2, err := job.sampleY(crand, n)
+		if err != nil {
+			wipePoly(y1, y2)
+			job.fail(err)
+			job.running.Done()
+			if crand.err != nil {
+				crand.wipe()
+				crand = newCrand()
+			}
+			continue
+		}
+		var sig *Signature
+		if !job.finished() {
+			sig, _ = job.sk.deterministicSign(y1, y2, job.dom, job.message)
+		}
+		wipePoly(y1, y2)
+		retry := job.report(n, sig)
+		job.running.Done()
+		if retry {
+			/*rejected. go to the tail of the queue to give other requests a chance*/
+			s.push(job, 1)
+		}
+	}
+}
+
+func (j *signJob) finished() bool {
+	return atomic.LoadInt32(&j.done) == 1 || j.ctx.Err() != nil
+}
+
+/*claim returns the number of the next trial, which must be followed by running.Done().*/
+func (j *signJob) claim() (uint64, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished() {
+		return 0, false
+	}
+	if j.best != nil && j.next >= j.bestN {
+		return 0, false
+	}
+	n := j.next
+	j.next++
+	j.inflight[n] = struct{}{}
+	j.running.Add(1)
+	return n, true
+}
+
+/*
+drain marks the job as done and waits for claimed trials to finish.
+done is set under mu so that no trial is claimed after that.
+*/
+func (j *signJob) drain() {
+	j.mu.Lock()
+	atomic.StoreInt32(&j.done, 1)
+	j.mu.Unlock()
+	if testHookDrain != nil {
+		testHookDrain()
+	}
+	j.running.Wait()
+}
+
+/*hooks called by a worker after claiming a trial and by drain before waiting for trials, only in tests*/
+var testHookClaimed, testHookDrain func()
+
+/*
+report records the result of the n-th trial, sends the signature if the job is completed,
+and returns true if more trials are needed.
+When derived from a seed, the accepted signature with the smallest n is chosen,
+so that the result doesn't depend on the number of workers.
+*/
+func (j *signJob) report(n uint64, sig *Signature) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.inflight, n)
+	if j.finished() {
+		return false
+	}
+	if sig != nil && (j.best == nil || n < j.bestN) {
+		j.best = sig
+		j.bestN = n
+	}
+	if j.best == nil {
+		return true
+	}
+	if j.seed != nil {
+		for m := range j.inflight {
+			if m < j.bestN {
+				return false
+			}
+		}
+	}
+	if atomic.CompareAndSwapInt32(&j.done, 0, 1) {
+		j.result <- &signResult{sig: j.best}
+	}
+	return false
+}
+
+/*sampleY samples y1,y2 for the n-th trial. crand is the one owned by the worker.*/
+func (j *signJob) sampleY(crand *crand, n uint64) ([]ringelt, []ringelt, error) {
+	params := j.sk.Params()
+	switch {
+	case j.seed != nil:
+		/*j.seed may be wiped concurrently after the job is done*/
+		j.mu.Lock()
+		c := newDetCrand(j.seed, n)
+		j.mu.Unlock()
+		defer c.wipe()
+		return c.sampleY(params)
+	case j.crand != nil:
+		j.randMu.Lock()
+		defer j.randMu.Unlock()
+		return j.crand.sampleY(params)
+	default:
+		return crand.sampleY(params)
+	}
+}
+
+/*wipe overwrites the seed of y and the buffer of crand of the job with zeros.*/
+func (j *signJob) wipe() {
+	j.mu.Lock()
+	wipe(j.seed)
+	j.mu.Unlock()
+	if j.crand != nil {
+		j.randMu.Lock()
+		j.crand.wipe()
+		j.randMu.Unlock()
+	}
+}
+
+func (j *signJob) fail(err error) {
+	if atomic.CompareAndSwapInt32(&j.done, 0, 1) {
+		j.result <- &signResult{err: err}
+	}
+}
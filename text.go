@@ -0,0 +1,429 @@
+// Copyright (c) 2018 Aidos Developer
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glyph
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+/*
+Text forms of keys and signatures are checksummed encodings of the framed encoding (by Encode),
+i.e. Bech32m (BIP 350) with a human-readable part and Base58Check.
+Note that Bech32m strings here are much longer than 90 characters, the limit for addresses in BIP 350,
+so typos are detected by the checksum with high probability but not always.
+*/
+
+//Human-readable parts of Bech32m.
+const (
+	HRPPublickey  = "glyphpk"
+	HRPSigningKey = "glyphsk"
+	HRPSignature  = "glyphsig"
+)
+
+const (
+	bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst  = 0x2bc830a3
+	base58Charset = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		b := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range gen {
+			if (b>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	v := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]>>5)
+	}
+	v = append(v, 0)
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]&31)
+	}
+	return v
+}
+
+/*convertBits regroups bits of data from from-bit groups to to-bit groups.*/
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	maxv := uint32(1)<<to - 1
+	for _, d := range data {
+		acc = acc<<from | uint32(d)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, fmt.Errorf("%w: invalid padding", ErrInvalidFormat)
+	}
+	return out, nil
+}
+
+/*bech32mEncode encodes 5-bit groups data with hrp.*/
+func bech32mEncode(hrp string, data []byte) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(values) ^ bech32mConst
+	wipe(values)
+	var s strings.Builder
+	s.Grow(len(hrp) + 1 + len(data) + 6)
+	s.WriteString(hrp)
+	s.WriteByte('1')
+	for _, d := range data {
+		s.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		s.WriteByte(bech32Charset[(mod>>uint(5*(5-i)))&31])
+	}
+	return s.String()
+}
+
+/*bech32mDecode decodes s into hrp and 5-bit groups, verifying the checksum.*/
+func bech32mDecode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("%w: mixed case", ErrInvalidFormat)
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, fmt.Errorf("%w: invalid separator", ErrInvalidFormat)
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("%w: invalid character in human-readable part", ErrInvalidFormat)
+		}
+	}
+	data := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, fmt.Errorf("%w: invalid character %q", ErrInvalidFormat, s[i])
+		}
+		data = append(data, byte(d))
+	}
+	values := append(bech32HRPExpand(hrp), data...)
+	mod := bech32Polymod(values)
+	wipe(values)
+	if mod != bech32mConst {
+		wipe(data)
+		return "", nil, ErrInvalidChecksum
+	}
+	return hrp, data[:len(data)-6], nil
+}
+
+func base58Encode(b []byte) string {
+	zeros := 0
+	for zeros < len(b) && b[zeros] == 0 {
+		zeros++
+	}
+	/*digits in base 58, little endian*/
+	digits := make([]byte, 0, len(b)*138/100+1)
+	for _, v := range b[zeros:] {
+		carry := uint32(v)
+		for i := range digits {
+			carry += uint32(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = base58Charset[0]
+	}
+	for i, d := range digits {
+		out[len(out)-1-i] = base58Charset[d]
+	}
+	wipe(digits)
+	defer wipe(out)
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Charset[0] {
+		zeros++
+	}
+	/*bytes, little endian*/
+	b := make([]byte, 0, len(s)*733/1000+1)
+	for i := zeros; i < len(s); i++ {
+		d := strings.IndexByte(base58Charset, s[i])
+		if d < 0 {
+			return nil, fmt.Errorf("%w: invalid character %q", ErrInvalidFormat, s[i])
+		}
+		carry := uint32(d)
+		for j := range b {
+			carry += uint32(b[j]) * 58
+			b[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			b = append(b, byte(carry))
+			carry >>= 8
+		}
+	}
+	out := make([]byte, zeros+len(b))
+	for i, v := range b {
+		out[len(out)-1-i] = v
+	}
+	wipe(b)
+	return out, nil
+}
+
+func base58Checksum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	h = sha256.Sum256(h[:])
+	return h[:4]
+}
+
+func base58CheckEncode(b []byte) string {
+	bb := append(append([]byte(nil), b...), base58Checksum(b)...)
+	defer wipe(bb)
+	return base58Encode(bb)
+}
+
+func base58CheckDecode(s string) ([]byte, error) {
+	b, err := base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidFormat)
+	}
+	b, sum := b[:len(b)-4], b[len(b)-4:]
+	if !bytes.Equal(sum, base58Checksum(b)) {
+		wipe(b)
+		return nil, ErrInvalidChecksum
+	}
+	return b, nil
+}
+
+func encodeBech32m(hrp string, b []byte) string {
+	data, err := convertBits(b, 8, 5, true)
+	if err != nil {
+		panic(err)
+	}
+	defer wipe(data)
+	return bech32mEncode(hrp, data)
+}
+
+/*maxFramedSize returns the largest framed encoding of all parameter sets, whose raw size is size.*/
+func maxFramedSize(size func(*Params) int) int {
+	max := 0
+	for _, p := range paramSets {
+		if l := headerSize + size(p); l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+/*
+decodeText decodes s in Bech32m with hrp or Base58Check, which is at most maxSize bytes.
+Too long s is rejected before decoding, because decoding Base58 takes quadratic time.
+*/
+func decodeText(s []byte, hrp string, maxSize int) ([]byte, error) {
+	str := string(s)
+	if strings.HasPrefix(strings.ToLower(str), hrp+"1") {
+		if max := len(hrp) + 1 + (maxSize*8+4)/5 + 6; len(str) > max {
+			return nil, lengthError("text", len(str))
+		}
+		h, data, err := bech32mDecode(str)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(data)
+		if h != hrp {
+			return nil, fmt.Errorf("%w: human-readable part %q is not %q", ErrInvalidFormat, h, hrp)
+		}
+		return convertBits(data, 5, 8, false)
+	}
+	if max := (maxSize+4)*138/100 + 1; len(str) > max {
+		return nil, lengthError("text", len(str))
+	}
+	return base58CheckDecode(str)
+}
+
+//Bech32m returns the Bech32m string of pk with HRPPublickey.
+func (p *Publickey) Bech32m() string {
+	return encodeBech32m(HRPPublickey, p.Encode())
+}
+
+//Base58Check returns the Base58Check string of pk.
+func (p *Publickey) Base58Check() string {
+	return base58CheckEncode(p.Encode())
+}
+
+//MarshalText returns the Bech32m string of pk, which implements encoding.TextMarshaler.
+func (p *Publickey) MarshalText() ([]byte, error) {
+	return []byte(p.Bech32m()), nil
+}
+
+//UnmarshalText sets pk from a string in Bech32m or Base58Check, which implements encoding.TextUnmarshaler.
+func (p *Publickey) UnmarshalText(s []byte) error {
+	b, err := decodeText(s, HRPPublickey, maxFramedSize((*Params).PKSize))
+	if err != nil {
+		return err
+	}
+	return p.UnmarshalBinary(b)
+}
+
+//MarshalBinary returns the framed encoding of pk, which implements encoding.BinaryMarshaler.
+func (p *Publickey) MarshalBinary() ([]byte, error) {
+	return p.Encode(), nil
+}
+
+//UnmarshalBinary sets pk from b in the form accepted by NewPublickey, which implements encoding.BinaryUnmarshaler.
+func (p *Publickey) UnmarshalBinary(b []byte) error {
+	pk, err := NewPublickey(b)
+	if err != nil {
+		return err
+	}
+	*p = *pk
+	return nil
+}
+
+//Bech32m returns the Bech32m string of sk with HRPSigningKey.
+func (s *SigningKey) Bech32m() string {
+	b := s.Encode()
+	defer wipe(b)
+	return encodeBech32m(HRPSigningKey, b)
+}
+
+//Base58Check returns the Base58Check string of sk.
+func (s *SigningKey) Base58Check() string {
+	b := s.Encode()
+	defer wipe(b)
+	return base58CheckEncode(b)
+}
+
+//MarshalText returns ErrSecretExport. Use Bech32m or Exportable to marshal sk.
+func (s *SigningKey) MarshalText() ([]byte, error) {
+	return nil, ErrSecretExport
+}
+
+//UnmarshalText sets sk from a string in Bech32m or Base58Check, which implements encoding.TextUnmarshaler.
+func (s *SigningKey) UnmarshalText(str []byte) error {
+	b, err := decodeText(str, HRPSigningKey, maxFramedSize((*Params).SKSize))
+	if err != nil {
+		return err
+	}
+	defer wipe(b)
+	return s.UnmarshalBinary(b)
+}
+
+//MarshalBinary returns ErrSecretExport. Use Encode or Exportable to marshal sk.
+func (s *SigningKey) MarshalBinary() ([]byte, error) {
+	return nil, ErrSecretExport
+}
+
+//UnmarshalBinary sets sk from b in the form accepted by NewSigningKey, which implements encoding.BinaryUnmarshaler.
+func (s *SigningKey) UnmarshalBinary(b []byte) error {
+	sk, err := NewSigningKey(b)
+	if err != nil {
+		return err
+	}
+	return s.replace(sk)
+}
+
+//MarshalText returns the Bech32m string of e, which implements encoding.TextMarshaler.
+func (e *ExportableSigningKey) MarshalText() ([]byte, error) {
+	return []byte(e.SigningKey().Bech32m()), nil
+}
+
+//UnmarshalText sets e from a string in Bech32m or Base58Check, which implements encoding.TextUnmarshaler.
+func (e *ExportableSigningKey) UnmarshalText(str []byte) error {
+	return e.SigningKey().UnmarshalText(str)
+}
+
+//MarshalBinary returns the framed encoding of e, which implements encoding.BinaryMarshaler.
+func (e *ExportableSigningKey) MarshalBinary() ([]byte, error) {
+	return e.SigningKey().Encode(), nil
+}
+
+//UnmarshalBinary sets e from b in the form accepted by NewSigningKey, which implements encoding.BinaryUnmarshaler.
+func (e *ExportableSigningKey) UnmarshalBinary(b []byte) error {
+	return e.SigningKey().UnmarshalBinary(b)
+}
+
+//Bech32m returns the Bech32m string of sig with HRPSignature.
+func (s *Signature) Bech32m() string {
+	return encodeBech32m(HRPSignature, s.Encode())
+}
+
+//Base58Check returns the Base58Check string of sig.
+func (s *Signature) Base58Check() string {
+	return base58CheckEncode(s.Encode())
+}
+
+//MarshalText returns the Bech32m string of sig, which implements encoding.TextMarshaler.
+func (s *Signature) MarshalText() ([]byte, error) {
+	return []byte(s.Bech32m()), nil
+}
+
+//UnmarshalText sets sig from a string in Bech32m or Base58Check, which implements encoding.TextUnmarshaler.
+func (s *Signature) UnmarshalText(str []byte) error {
+	b, err := decodeText(str, HRPSignature, maxFramedSize((*Params).SigSize))
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalBinary(b)
+}
+
+//MarshalBinary returns the framed encoding of sig, which implements encoding.BinaryMarshaler.
+func (s *Signature) MarshalBinary() ([]byte, error) {
+	return s.Encode(), nil
+}
+
+//UnmarshalBinary sets sig from b in the form accepted by NewSignature, which implements encoding.BinaryUnmarshaler.
+func (s *Signature) UnmarshalBinary(b []byte) error {
+	sig, err := NewSignature(b)
+	if err != nil {
+		return err
+	}
+	*s = *sig
+	return nil
+}
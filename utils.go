@@ -21,50 +21,101 @@
 package glyph
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/sha256"
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"sort"
 )
 
+/*wipe overwrites b with zeros.*/
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/*wipePoly overwrites polynomials with zeros.*/
+func wipePoly(fs ...[]ringelt) {
+	for _, f := range fs {
+		for i := range f {
+			f[i] = 0
+		}
+	}
+}
+
+/*isZero returns true if all bytes of b are zero.*/
+func isZero(b []byte) bool {
+	var x byte
+	for _, v := range b {
+		x |= v
+	}
+	return x == 0
+}
+
 /*hash function */
-/*input: one polynomial, mu (usually itself a message digest),
-  and the length of mu in bytes*/
+/*input: prefix for domain separation, one polynomial, mu (usually itself a message digest)*/
 /*output: a 256-bit hash */
 
-func hash(u [constN]ringelt, mu []byte) [glpDigestLength]byte {
-	bytesPerPoly := constN * 2
-	hashInput := make([]byte, bytesPerPoly+len(mu))
+func hash(u []ringelt, dom, mu []byte) [glpDigestLength]byte {
+	poly := make([]byte, len(u)*2)
 	for i, x := range u {
-		binary.LittleEndian.PutUint16(hashInput[2*i:], uint16(x))
+		binary.LittleEndian.PutUint16(poly[2*i:], uint16(x))
+	}
+	h := sha256.New()
+	h.Write(dom)
+	h.Write(poly)
+	h.Write(mu)
+	wipe(poly)
+	var out [glpDigestLength]byte
+	h.Sum(out[:0])
+	return out
+}
+
+const domPrefix = "GLYPH domain"
+
+/*
+domain returns the prefix of the input of the hash function for domain separation,
+i.e. domPrefix || (1 if pre-hashed, 0 otherwise) || h || len(ctx) || ctx.
+In pure mode with empty context the prefix is empty for compatibility.
+Prefixed inputs never collide with it, because the first byte of the prefix is not 0 or 1,
+while rounded coefficients of u are always 0 or 1.
+*/
+func domain(h crypto.Hash, ctx string) []byte {
+	if h == crypto.Hash(0) && ctx == "" {
+		return nil
+	}
+	var ph byte
+	if h != crypto.Hash(0) {
+		ph = 1
 	}
-	copy(hashInput[bytesPerPoly:], mu)
-	return sha256.Sum256(hashInput)
+	dom := append([]byte(domPrefix), ph, byte(h), byte(len(ctx)))
+	return append(dom, ctx...)
 }
 
-func sparseMul(a [constN]ringelt, b *sparsePolyST) [constN]ringelt {
-	var vaux [2 * constN]ringelt
-	var v [constN]ringelt
+func (p *Params) sparseMul(a []ringelt, b sparsePolyST) []ringelt {
+	vaux := make([]ringelt, 2*p.n)
+	v := p.newPoly()
 
 	/*multiply in Z[x]*/
 	for _, vb := range b {
-		for j := uint16(0); j < constN; j++ {
+		for j := 0; j < p.n; j++ {
 			if vb.sign {
-				vaux[vb.pos+j] = addMOD(vaux[vb.pos+j], a[j])
+				vaux[int(vb.pos)+j] = p.addMOD(vaux[int(vb.pos)+j], a[j])
 			} else {
-				vaux[vb.pos+j] = subMOD(vaux[vb.pos+j], a[j])
+				vaux[int(vb.pos)+j] = p.subMOD(vaux[int(vb.pos)+j], a[j])
 			}
 		}
 	}
 	/*reduce mod x^n + 1*/
-	for i := 0; i < constN; i++ {
-		v[i] = subMOD(vaux[i], vaux[i+constN])
+	for i := 0; i < p.n; i++ {
+		v[i] = p.subMOD(vaux[i], vaux[i+p.n])
 	}
 	return v
 }
 
-func encodeSparse(hashOutput [glpDigestLength]byte) (*sparsePolyST, error) {
+func (p *Params) encodeSparse(hashOutput [glpDigestLength]byte) (sparsePolyST, error) {
 	/*key AES on hash output*/
 	/*initialise AES */
 	iv := make([]byte, aes.BlockSize)
@@ -72,13 +123,13 @@ func encodeSparse(hashOutput [glpDigestLength]byte) (*sparsePolyST, error) {
 	if err != nil {
 		return nil, err
 	}
-	var encodeOutput sparsePolyST
+	encodeOutput := make(sparsePolyST, p.omega)
 	/*get OMEGA values in [0,n), each with a 0 or 1 to indicate sign*/
 	rand64 := r.please2()
 	randBitsUsed := 0
-	for i := 0; i < omega; i++ {
+	for i := 0; i < p.omega; i++ {
 		for {
-			if randBitsUsed+nBits+1 > 64 {
+			if randBitsUsed+int(p.nBits)+1 > 64 {
 				rand64 = r.please2()
 				randBitsUsed = 0
 			}
@@ -87,12 +138,12 @@ func encodeSparse(hashOutput [glpDigestLength]byte) (*sparsePolyST, error) {
 			sign := rand64 & 1
 			rand64 >>= 1
 			randBitsUsed++
-			pos := uint16(rand64 & (^((^0) << nBits)))
-			rand64 >>= nBits
-			randBitsUsed += nBits
+			pos := uint16(rand64 & (1<<p.nBits - 1))
+			rand64 >>= p.nBits
+			randBitsUsed += int(p.nBits)
 
 			/*get position from random*/
-			if pos < constN {
+			if int(pos) < p.n {
 				/*check we are not using this position already */
 				success := true
 				for j := 0; j < i; j++ {
@@ -110,38 +161,38 @@ func encodeSparse(hashOutput [glpDigestLength]byte) (*sparsePolyST, error) {
 			}
 		}
 	}
-	sort.Slice(encodeOutput[:], func(i, j int) bool {
+	sort.Slice(encodeOutput, func(i, j int) bool {
 		return encodeOutput[i].pos < encodeOutput[j].pos
 	})
-	return &encodeOutput, nil
+	return encodeOutput, nil
 }
 
-func kfloor(f *[constN]ringelt) {
+func (p *Params) kfloor(f []ringelt) {
 	/*integer division by  2*K+1 where K = B - omega */
 	for i, vf := range f {
-		f[i] = vf / (2*(constB-omega) + 1)
+		f[i] = p.divK(vf)
 	}
 }
 
-func compressCoefficient(u, v ringelt) (ringelt, error) {
-	k := ringelt(constB - omega)
-	if abs(v) > k {
-		return 0, errors.New("invalid v")
+func (p *Params) compressCoefficient(u, v ringelt) (ringelt, error) {
+	k := p.k()
+	if p.abs(v) > k {
+		return 0, fmt.Errorf("%w: |v| exceeds K", ErrMalformedSignature)
 	}
-	kfloorUV := ((u + v) % constQ) / (2*k + 1)
+	kfloorUV := ringelt((uint32(u)+uint32(v))%uint32(p.q)) / (2*k + 1)
 	kfloorU := u / (2*k + 1)
 
 	if kfloorUV == kfloorU {
 		return 0, nil
 	}
 	if u < k {
-		return constQ - k, nil
+		return p.q - k, nil
 	}
-	if (u >= constQ-k) && sign(v) > 0 {
+	if (u >= p.q-k) && p.sign(v) > 0 {
 		return k, nil
 	}
 	if kfloorUV < kfloorU {
-		return constQ - k, nil
+		return p.q - k, nil
 	}
 	return k, nil
 }